@@ -7,7 +7,9 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"sync"
 )
 
 // Fastrex ..
@@ -17,10 +19,20 @@ type Fastrex func(app App) App
 type App interface {
 	// Add app module
 	Register(app Fastrex, url ...string) App
-	// Sets Dependency
+	// Sets Dependency. Dependencies are read-only once the app starts serving;
+	// use Request.Set for per-request values.
 	Add(name string, i interface{}) App
 	// Get Dependency
 	Dependency(name string) interface{}
+	// Registers a factory function whose result type can be resolved with Resolve.
+	// Its parameters are resolved by type from the other providers. The factory may
+	// return an error as second value. Instances implementing io.Closer are closed
+	// at the end of the request (scoped and transient) or on Shutdown (singletons
+	// and the transients they depend on). Transients from App.Resolve are left to
+	// the caller to close.
+	Provide(lifetime Lifetime, factory interface{}) App
+	// Sets target, a pointer, to the singleton or transient instance of its type.
+	Resolve(target interface{}) error
 	// Routes HTTP GET requests to the specified path with the specified callback functions.
 	Get(string, Handler, ...Middleware) App
 	// Routes HTTP CONNECT requests to the specified path with the specified callback functions
@@ -37,6 +49,13 @@ type App interface {
 	Trace(string, Handler, ...Middleware) App
 	// Routes HTTP POST requests to the specified path with the specified callback functions
 	Post(string, Handler, ...Middleware) App
+	// Routes WebSocket upgrade requests to the specified path. The middleware runs before
+	// the upgrade, so it can reject the request with a normal response.
+	WS(string, WSHandler, ...Middleware) App
+	// Sets the function that accepts or rejects the Origin of WebSocket handshakes.
+	// By default handshakes without an Origin header, or whose Origin host is the
+	// request host, are accepted and others are rejected with 403.
+	CheckOrigin(check func(Request) bool) App
 	// Mounts the specified middleware function
 	Use(Middleware) App
 	// Sets static files
@@ -51,10 +70,40 @@ type App interface {
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 	// Sets app serverless
 	Serverless(bool) App
+	// Sets which proxies are trusted to report the client address, protocol and host.
+	// Accepts true to trust every peer, a hop count, or CIDRs and addresses as a
+	// comma-separated string or []string. The presets "loopback", "linklocal" and
+	// "uniquelocal" are recognised.
+	TrustProxy(value interface{}) App
+	// Sets how many dot-separated labels Request.Subdomains treats as the domain. Defaults to 2.
+	SubdomainOffset(offset int) App
+	// Sets how Response.Json encodes values.
+	JSONEncoding(opts JSONEncodeOptions) App
+	// Sets the keys for signed and encrypted cookies. The first key signs and encrypts,
+	// every key is tried when verifying, so keys can be rotated by prepending a new one.
+	// Keys must be at least 16 bytes.
+	CookieKeys(keys ...[]byte) App
+	// Sets the Secure, HttpOnly and SameSite attributes applied to cookies that do not
+	// set them. Cookies that break the prefix and attribute rules are not sent.
+	CookiePolicy(policy CookiePolicy) App
+	// Sends framework errors (404, middleware errors, panics) and SendError responses
+	// as RFC 7807 application/problem+json. It also answers a known path requested with
+	// an unrouted method with 405 and an Allow header. Panics are only recovered in
+	// this mode; otherwise they reach net/http as usual.
+	ProblemDetails(enabled bool) App
+	// Registers the codec Response.Encode and Request.Bind use for a media type, or
+	// removes the media type when codec is nil. JSON, XML, CSV and MessagePack are
+	// registered by default.
+	Codec(mediaType string, codec Codec) App
 	// Sets a host name
 	Host(string) App
 	// ParseFiles creates a new Template and parses the template definitions from the named files.
 	Template(path string) App
+	// Loads views, layouts and partials from a directory, see ViewOptions.
+	Views(opts ViewOptions) App
+	// Registers functions for Template and Views. They are added before the templates
+	// are parsed; a module gets the functions of the app it is registered on as well.
+	Funcs(funcs template.FuncMap) App
 	// SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled. By default, keep-alives
 	// are always enabled. Only very resource-constrained environments or servers in the process of
 	// shutting down should disable them.
@@ -125,6 +174,7 @@ type AppRoute struct {
 	method      string
 	handler     Handler
 	middlewares []Middleware
+	injector    *injector
 }
 
 type app struct {
@@ -132,9 +182,12 @@ type app struct {
 	server     *http.Server
 	ctx        context.Context
 	container  map[string]interface{}
+	injector   *injector
 	routes     map[string]AppRoute
 	filename   []string
 	serverless bool
+	started    bool
+	settings   settings
 
 	host              string
 	apps              map[string]App
@@ -149,6 +202,29 @@ type app struct {
 
 	template       *template.Template
 	moduleTemplate map[string]*template.Template
+	funcs          template.FuncMap
+	viewOptions    *ViewOptions
+	views          *views
+
+	// once builds serve, the handler shared by every ServeHTTP call, or sets err
+	// when the app cannot be prepared.
+	once  sync.Once
+	serve http.Handler
+	err   error
+}
+
+// settings holds the app options read by Request and Response.
+type settings struct {
+	trustProxy      trustProxy
+	subdomainOffset int
+	json            JSONEncodeOptions
+	cookieKeys      []cookieKey
+	cookiePolicy    CookiePolicy
+	problems        bool
+	checkOrigin     func(Request) bool
+	codecs          []codecEntry
+	views           *views
+	moduleViews     map[string]*views
 }
 
 const (
@@ -160,6 +236,7 @@ func New() App {
 	return &app{
 		apps:               map[string]App{},
 		container:          map[string]interface{}{},
+		injector:           newInjector(),
 		routes:             map[string]AppRoute{},
 		middlewares:        []Middleware{},
 		moduleMiddlewares:  map[string][]Middleware{},
@@ -204,6 +281,9 @@ func (r *app) Register(app Fastrex, url ...string) App {
 }
 
 func (r *app) Add(name string, i interface{}) App {
+	if r.started {
+		panic("fastrex: Add called after the app started serving")
+	}
 	r.container[name] = i
 	return r
 }
@@ -212,6 +292,20 @@ func (r *app) Dependency(name string) interface{} {
 	return r.container[name]
 }
 
+func (r *app) Provide(lifetime Lifetime, factory interface{}) App {
+	if r.started {
+		panic("fastrex: Provide called after the app started serving")
+	}
+	if err := r.injector.provide(lifetime, factory); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func (r *app) Resolve(target interface{}) error {
+	return r.injector.into(target, nil)
+}
+
 func (r *app) Use(m Middleware) App {
 	if m != nil {
 		r.middlewares = append(r.middlewares, m)
@@ -229,12 +323,13 @@ func (r *app) Ctx(ctx context.Context) App {
 	return r
 }
 
-func (r *app) mutate() {
+func (r *app) mutate() error {
 	for url, app := range r.apps {
 		if url == "" {
 			url = "/"
 		}
 		newPath := url
+		moduleInjector := r.linkInjector(app)
 		if len(app.Middleware()) > 0 {
 			r.moduleMiddlewares[newPath] = app.Middleware()
 		}
@@ -244,12 +339,23 @@ func (r *app) mutate() {
 		if len(app.StaticPath()) > 0 {
 			r.moduleStaticPath[newPath] = app.StaticPath()
 		}
+		funcs := r.funcs
+		if m := moduleApp(app); m != nil {
+			funcs = mergeFuncs(r.funcs, m.funcs)
+			if err := m.handleViews(funcs); err != nil {
+				return err
+			}
+			if m.views != nil {
+				if r.settings.moduleViews == nil {
+					r.settings.moduleViews = map[string]*views{}
+				}
+				r.settings.moduleViews[newPath] = m.views
+			}
+		}
 		if len(app.Templates()) > 0 {
-			fmt.Println("app.Templates()", app.Templates())
-			tmpl, err := template.ParseFiles(app.Templates()...)
-			fmt.Println("tmpl", tmpl)
+			tmpl, err := parseTemplateFiles(funcs, app.Templates())
 			if err != nil {
-				panic(err)
+				return err
 			}
 			r.moduleTemplate[newPath] = tmpl
 		}
@@ -265,27 +371,36 @@ func (r *app) mutate() {
 				method:      route.method,
 				handler:     route.handler,
 				middlewares: route.middlewares,
+				injector:    moduleInjector,
 			}
 			r.routes[newKey] = newRoute
 		}
 	}
+	return nil
+}
 
-	if len(r.filename) > 0 {
-		err := r.handleTemplate()
-		if err != nil {
-			panic(err)
+// prepare merges the modules into the app, which links their injectors, validates
+// every provider and loads the views. It runs once, before the app starts serving.
+func (r *app) prepare() error {
+	if len(r.apps) > 0 {
+		if err := r.mutate(); err != nil {
+			return err
 		}
 	}
+	if err := r.validateProviders(); err != nil {
+		return err
+	}
+	if err := r.handleViews(r.funcs); err != nil {
+		return err
+	}
+	r.started = true
+	return nil
 }
 
 func (r *app) handler(serverless bool) http.Handler {
-	if len(r.apps) > 0 {
-		r.mutate()
-	}
-
 	return &httpHandler{
 		apps:               r.apps,
-		container:          r.container,
+		container:          copyContainer(r.container),
 		routes:             r.routes,
 		logger:             r.logger,
 		ctx:                r.ctx,
@@ -298,9 +413,58 @@ func (r *app) handler(serverless bool) http.Handler {
 		moduleMiddlewares:  r.moduleMiddlewares,
 		template:           r.template,
 		moduleTemplate:     r.moduleTemplate,
+		injector:           r.injector,
+		settings:           r.settings,
 	}
 }
 
+// moduleApp returns the module as *app, or nil for other App implementations.
+func moduleApp(module App) *app {
+	m, _ := module.(*app)
+	return m
+}
+
+// linkInjector makes the app providers visible to a module that declares its own,
+// and returns the module injector, or nil when the module has no providers.
+func (r *app) linkInjector(module App) *injector {
+	m, ok := module.(*app)
+	if !ok || m.injector == nil || len(m.injector.providers) == 0 {
+		return nil
+	}
+	m.injector.parent = r.injector
+	return m.injector
+}
+
+func (r *app) validateProviders() error {
+	if r.injector == nil {
+		return nil
+	}
+	if err := r.injector.validate(); err != nil {
+		return err
+	}
+	for _, module := range r.apps {
+		if m, ok := module.(*app); ok && m.injector.parent == r.injector {
+			if err := m.injector.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyContainer snapshots the app dependencies so handlers never share a map
+// that can still be written to.
+func copyContainer(container map[string]interface{}) map[string]interface{} {
+	if container == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(container))
+	for k, v := range container {
+		c[k] = v
+	}
+	return c
+}
+
 func (r *app) Close() error {
 	return r.server.Close()
 }
@@ -318,6 +482,18 @@ func (r *app) Shutdown(ctx context.Context) {
 	if err != nil {
 		log.Println(err)
 	}
+	for _, module := range r.apps {
+		if m, ok := module.(*app); ok && m.injector != nil {
+			if err := m.injector.dispose(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	if r.injector != nil {
+		if err := r.injector.dispose(); err != nil {
+			log.Println(err)
+		}
+	}
 }
 
 func (r *app) listenAndServe(addr string) error {
@@ -343,17 +519,32 @@ func (r *app) Serverless(serverless bool) App {
 }
 
 func (r *app) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	if len(r.filename) > 0 {
-		err := r.handleTemplate()
-		if err != nil && r.logger != nil {
-			r.logger.Println(err)
+	r.once.Do(func() {
+		if r.err = r.prepare(); r.err != nil {
+			if r.logger != nil {
+				r.logger.Println(r.err)
+			}
+			return
+		}
+		if len(r.filename) > 0 {
+			err := r.handleTemplate()
+			if err != nil && r.logger != nil {
+				r.logger.Println(err)
+			}
 		}
+		r.serve = r.handler(true)
+	})
+	if r.err != nil {
+		sendStatusError(res, r.settings.problems, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
 	}
-	h := r.handler(true)
-	h.ServeHTTP(res, req)
+	r.serve.ServeHTTP(res, req)
 }
 
 func (r *app) Listen(port int, args ...interface{}) error {
+	if err := r.prepare(); err != nil {
+		return err
+	}
 	if len(r.filename) > 0 {
 		err := r.handleTemplate()
 		if err != nil {
@@ -374,7 +565,7 @@ func (r *app) handleTemplate() error {
 		r.transform()
 	}
 
-	tmpl, err := template.ParseFiles(r.filename...)
+	tmpl, err := parseTemplateFiles(r.funcs, r.filename)
 	if err != nil {
 		return err
 	}
@@ -382,6 +573,32 @@ func (r *app) handleTemplate() error {
 	return nil
 }
 
+// parseTemplateFiles is template.ParseFiles with funcs added before parsing.
+func parseTemplateFiles(funcs template.FuncMap, filenames []string) (*template.Template, error) {
+	if len(filenames) == 0 {
+		return template.ParseFiles()
+	}
+	return template.New(filepath.Base(filenames[0])).Funcs(funcs).ParseFiles(filenames...)
+}
+
+// handleViews loads the views configured with Views once.
+func (r *app) handleViews(funcs template.FuncMap) error {
+	if r.viewOptions == nil || r.views != nil {
+		return nil
+	}
+	opts := *r.viewOptions
+	if r.serverless {
+		opts.Dir = serverlessFolder + opts.Dir
+	}
+	v, err := loadViews(opts, funcs)
+	if err != nil {
+		return err
+	}
+	r.views = v
+	r.settings.views = v
+	return nil
+}
+
 func (r *app) transform() {
 	filename := make([]string, 0)
 	for _, v := range r.filename {
@@ -477,6 +694,70 @@ func (r *app) Template(filename string) App {
 	return r
 }
 
+func (r *app) Views(opts ViewOptions) App {
+	r.viewOptions = &opts
+	r.views = nil
+	r.settings.views = nil
+	return r
+}
+
+func (r *app) Funcs(funcs template.FuncMap) App {
+	r.funcs = mergeFuncs(r.funcs, funcs)
+	r.views = nil
+	r.settings.views = nil
+	return r
+}
+
+func (r *app) TrustProxy(value interface{}) App {
+	t, err := parseTrustProxy(value)
+	if err != nil {
+		panic(err)
+	}
+	r.settings.trustProxy = t
+	return r
+}
+
+func (r *app) SubdomainOffset(offset int) App {
+	r.settings.subdomainOffset = offset
+	return r
+}
+
+func (r *app) CookieKeys(keys ...[]byte) App {
+	if len(keys) == 0 {
+		panic("cookie error: at least one key is required")
+	}
+	ring := make([]cookieKey, 0, len(keys))
+	for _, k := range keys {
+		key, err := newCookieKey(k)
+		if err != nil {
+			panic(err)
+		}
+		ring = append(ring, key)
+	}
+	r.settings.cookieKeys = ring
+	return r
+}
+
+func (r *app) CookiePolicy(policy CookiePolicy) App {
+	r.settings.cookiePolicy = policy
+	return r
+}
+
+func (r *app) ProblemDetails(enabled bool) App {
+	r.settings.problems = enabled
+	return r
+}
+
+func (r *app) Codec(mediaType string, codec Codec) App {
+	r.settings.setCodec(mediaType, codec)
+	return r
+}
+
+func (r *app) JSONEncoding(opts JSONEncodeOptions) App {
+	r.settings.json = opts
+	return r
+}
+
 func (r *app) Host(host string) App {
 	r.host = host
 	return r
@@ -503,56 +784,56 @@ func appendMiddleware(m []Middleware) []Middleware {
 }
 
 func (r *app) Get(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodGet, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodGet, handler, appendMiddleware(middleware), nil}
 	key := http.MethodGet + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Connect(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodConnect, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodConnect, handler, appendMiddleware(middleware), nil}
 	key := http.MethodConnect + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Delete(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodDelete, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodDelete, handler, appendMiddleware(middleware), nil}
 	key := http.MethodDelete + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Head(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodHead, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodHead, handler, appendMiddleware(middleware), nil}
 	key := http.MethodHead + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Put(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodPut, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodPut, handler, appendMiddleware(middleware), nil}
 	key := http.MethodPut + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Patch(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodPatch, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodPatch, handler, appendMiddleware(middleware), nil}
 	key := http.MethodPatch + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Trace(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodTrace, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodTrace, handler, appendMiddleware(middleware), nil}
 	key := http.MethodTrace + splitter + path
 	r.routes[key] = route
 	return r
 }
 
 func (r *app) Post(path string, handler Handler, middleware ...Middleware) App {
-	route := AppRoute{path, http.MethodPost, handler, appendMiddleware(middleware)}
+	route := AppRoute{path, http.MethodPost, handler, appendMiddleware(middleware), nil}
 	key := http.MethodPost + splitter + path
 	r.routes[key] = route
 	return r
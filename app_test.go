@@ -5,7 +5,9 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -19,6 +21,7 @@ func TestNew(t *testing.T) {
 			want: &app{
 				apps:               map[string]App{},
 				container:          make(map[string]interface{}),
+				injector:           newInjector(),
 				routes:             map[string]AppRoute{},
 				middlewares:        []Middleware{},
 				moduleMiddlewares:  map[string][]Middleware{},
@@ -548,3 +551,35 @@ func Test_app_GetDependency(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_ServeHTTP_concurrent(t *testing.T) {
+	app := New()
+	app.Add("name", "fastrex")
+	app.Get("/", func(req Request, res Response) {
+		res.Send(req.GetDependency("name"))
+	})
+	app.Register(func(module App) App {
+		module.Get("/", func(req Request, res Response) {
+			res.Send("module")
+		})
+		return module
+	}, "/admin")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, want := "/", "fastrex"
+			if i%2 == 1 {
+				path, want = "/admin", "module"
+			}
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if w.Body.String() != want {
+				t.Errorf("app.ServeHTTP(%v) = %q, want %q", path, w.Body, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
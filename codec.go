@@ -0,0 +1,225 @@
+package fastrex
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+const (
+	MimeApplicationXml     = "application/xml"
+	MimeTextCsv            = "text/csv"
+	MimeApplicationMsgpack = "application/msgpack"
+	defaultBindMaxBytes    = 1 << 20
+)
+
+// Codec encodes response bodies and decodes request bodies of one media type.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+type codecEntry struct {
+	mediaType string
+	codec     Codec
+}
+
+// defaultCodecs is the registry used until App.Codec changes it. The order decides
+// which codec Response.Encode uses when the client accepts several equally.
+var defaultCodecs = []codecEntry{
+	{MimeApplicationJson, JSONCodec{}},
+	{MimeApplicationXml, XMLCodec{}},
+	{"text/xml", XMLCodec{}},
+	{MimeTextCsv, CSVCodec{}},
+	{MimeApplicationMsgpack, MsgpackCodec{}},
+	{"application/x-msgpack", MsgpackCodec{}},
+}
+
+func (s *settings) codecList() []codecEntry {
+	if s == nil || s.codecs == nil {
+		return defaultCodecs
+	}
+	return s.codecs
+}
+
+// setCodec registers codec for mediaType, replacing an existing one in place. A nil
+// codec removes the media type.
+func (s *settings) setCodec(mediaType string, codec Codec) {
+	mediaType = normalizeType(mediaType)
+	list := []codecEntry{}
+	replaced := false
+	for _, e := range s.codecList() {
+		if e.mediaType != mediaType {
+			list = append(list, e)
+		} else if codec != nil {
+			list = append(list, codecEntry{mediaType, codec})
+			replaced = true
+		}
+	}
+	if !replaced && codec != nil {
+		list = append(list, codecEntry{mediaType, codec})
+	}
+	s.codecs = list
+}
+
+// findCodec returns the codec for mediaType. Structured syntax suffixes such as
+// "+json" fall back to the codec of their base type.
+func (s *settings) findCodec(mediaType string) (Codec, bool) {
+	list := s.codecList()
+	for _, e := range list {
+		if e.mediaType == mediaType {
+			return e.codec, true
+		}
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		base := "application/" + mediaType[i+1:]
+		for _, e := range list {
+			if e.mediaType == base {
+				return e.codec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// JSONCodec encodes with encoding/json. Response.Encode applies the App.JSONEncoding
+// options to it.
+type JSONCodec struct {
+	Options JSONEncodeOptions
+}
+
+// Encode ...
+func (c JSONCodec) Encode(w io.Writer, v interface{}) error {
+	data, err := c.Options.marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode ...
+func (c JSONCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func isDefaultJSONCodec(codec Codec) bool {
+	c, ok := codec.(JSONCodec)
+	return ok && reflect.DeepEqual(c, JSONCodec{})
+}
+
+// XMLCodec encodes with encoding/xml.
+type XMLCodec struct{}
+
+// Encode ...
+func (XMLCodec) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// Decode ...
+func (XMLCodec) Decode(r io.Reader, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+func (h *httpResponse) settings() *settings {
+	state := h.request().state
+	if state == nil {
+		return nil
+	}
+	return state.settings
+}
+
+// Encode sends data with the registered codec that best matches the Accept header,
+// or 406 when none is acceptable.
+func (h *httpResponse) Encode(data interface{}) {
+	s := h.settings()
+	offers := []string{}
+	for _, e := range s.codecList() {
+		offers = append(offers, e.mediaType)
+	}
+	h.Append("Vary", "Accept")
+	req := h.request()
+	mediaType := req.Accepts(offers...)
+	codec, ok := s.findCodec(mediaType)
+	if !ok {
+		sendStatusError(h.writer(), h.problems(), http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+		return
+	}
+	if isDefaultJSONCodec(codec) {
+		codec = JSONCodec{Options: h.jsonOptions()}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := codec.Encode(buf, data); err != nil {
+		h.SendError(err)
+		return
+	}
+	contentType := mediaType
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "xml") {
+		contentType += "; charset=utf-8"
+	}
+	h.writer().Header().Set(HeaderContentType, contentType)
+	if h.s != http.StatusOK {
+		h.writer().WriteHeader(h.s)
+	}
+	if _, err := h.writer().Write(buf.Bytes()); err != nil {
+		panic(err)
+	}
+}
+
+// Bind decodes the request body into v with the codec registered for its
+// Content-Type. Bodies without a Content-Type are decoded as JSON. JSON bodies are
+// decoded by Request.JSON unless App.Codec replaced the JSON codec.
+func (h *Request) Bind(v interface{}) error {
+	mediaType := MimeApplicationJson
+	if ct := h.Header.Get(HeaderContentType); ct != "" {
+		t, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return &statusError{code: http.StatusBadRequest, err: fmt.Errorf("bind error: %v", err)}
+		}
+		mediaType = t
+	}
+	var s *settings
+	if h.state != nil {
+		s = h.state.settings
+	}
+	codec, ok := s.findCodec(mediaType)
+	if !ok {
+		return &statusError{
+			code: http.StatusUnsupportedMediaType,
+			err:  errors.New("bind error: unsupported content type " + mediaType),
+		}
+	}
+	if isDefaultJSONCodec(codec) {
+		return h.JSON(v)
+	}
+
+	if h.Body == nil {
+		return &statusError{code: http.StatusBadRequest, err: errors.New("bind error: request body is empty")}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(h.Body, defaultBindMaxBytes+1))
+	if err != nil {
+		return &statusError{code: http.StatusBadRequest, err: fmt.Errorf("bind error: %v", err)}
+	}
+	if len(data) > defaultBindMaxBytes {
+		return &statusError{
+			code: http.StatusRequestEntityTooLarge,
+			err:  fmt.Errorf("bind error: request body must not be larger than %d bytes", defaultBindMaxBytes),
+		}
+	}
+	if err := codec.Decode(bytes.NewReader(data), v); err != nil {
+		return &statusError{code: http.StatusBadRequest, err: fmt.Errorf("bind error: %v", err)}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package fastrex
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type codecItem struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Encode(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, strings.ToUpper(v.(string)))
+	return err
+}
+
+func (upperCodec) Decode(r io.Reader, v interface{}) error {
+	b, err := ioutil.ReadAll(r)
+	*v.(*string) = strings.ToLower(string(b))
+	return err
+}
+
+func Test_httpResponse_Encode(t *testing.T) {
+	items := []codecItem{{1, "a"}, {2, "b"}}
+	tests := []struct {
+		name       string
+		app        App
+		accept     string
+		data       interface{}
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:       "no accept header",
+			app:        New(),
+			data:       items,
+			wantStatus: 200,
+			wantType:   MimeApplicationJson,
+			wantBody:   `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`,
+		},
+		{
+			name:       "json options",
+			app:        New().JSONEncoding(JSONEncodeOptions{Indent: " "}),
+			accept:     "application/json",
+			data:       codecItem{1, "a"},
+			wantStatus: 200,
+			wantType:   MimeApplicationJson,
+			wantBody:   "{\n \"id\": 1,\n \"name\": \"a\"\n}",
+		},
+		{
+			name:       "xml",
+			app:        New(),
+			accept:     "application/xml;q=0.9, application/json;q=0.5",
+			data:       codecItem{1, "a"},
+			wantStatus: 200,
+			wantType:   "application/xml; charset=utf-8",
+			wantBody:   xmlHeader + "<codecItem><id>1</id><name>a</name></codecItem>",
+		},
+		{
+			name:       "csv",
+			app:        New(),
+			accept:     "text/csv",
+			data:       items,
+			wantStatus: 200,
+			wantType:   "text/csv; charset=utf-8",
+			wantBody:   "id,name\n1,a\n2,b\n",
+		},
+		{
+			name:       "msgpack",
+			app:        New(),
+			accept:     "application/msgpack",
+			data:       codecItem{1, "a"},
+			wantStatus: 200,
+			wantType:   MimeApplicationMsgpack,
+			wantBody:   "\x82\xa2id\x01\xa4name\xa1a",
+		},
+		{
+			name:       "not acceptable",
+			app:        New(),
+			accept:     "image/png",
+			data:       items,
+			wantStatus: 406,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "Not Acceptable\n",
+		},
+		{
+			name:       "encode error",
+			app:        New(),
+			accept:     "text/csv",
+			data:       "not a slice",
+			wantStatus: 500,
+			wantType:   MimeApplicationJson,
+			wantBody:   `{"message":"Internal Server Error"}`,
+		},
+		{
+			name:       "custom codec",
+			app:        New().Codec("text/plain", upperCodec{}).Codec("application/xml", nil),
+			accept:     "application/xml, text/plain;q=0.1",
+			data:       "hello",
+			wantStatus: 200,
+			wantType:   "text/plain; charset=utf-8",
+			wantBody:   "HELLO",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.app.Get("/", func(req Request, res Response) {
+				res.Encode(tt.data)
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			tt.app.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get(HeaderContentType); got != tt.wantType {
+				t.Errorf("Content-Type = %v, want %v", got, tt.wantType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("Vary = %v, want Accept", got)
+			}
+		})
+	}
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+func TestRequest_Bind(t *testing.T) {
+	msgpack := &bytes.Buffer{}
+	MsgpackCodec{}.Encode(msgpack, codecItem{7, "mp"})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        codecItem
+		wantCode    int
+	}{
+		{name: "json", contentType: "application/json", body: `{"id":1,"name":"a"}`, want: codecItem{1, "a"}},
+		{name: "no content type", body: `{"id":2,"name":"b"}`, want: codecItem{2, "b"}},
+		{name: "json suffix", contentType: "application/vnd.api+json", body: `{"id":3}`, want: codecItem{ID: 3}},
+		{name: "strict json", contentType: "application/json", body: `{"id":1,"extra":true}`, wantCode: 400},
+		{name: "xml", contentType: "application/xml; charset=utf-8", body: "<item><id>4</id><name>x</name></item>", want: codecItem{4, "x"}},
+		{name: "msgpack", contentType: "application/x-msgpack", body: msgpack.String(), want: codecItem{7, "mp"}},
+		{name: "malformed xml", contentType: "text/xml", body: "<item>", wantCode: 400},
+		{name: "unsupported", contentType: "image/png", body: "png", wantCode: 415},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got codecItem
+			var err error
+			app := New()
+			app.Post("/", func(req Request, res Response) {
+				err = req.Bind(&got)
+			})
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(HeaderContentType, tt.contentType)
+			}
+			app.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tt.wantCode != 0 {
+				coder, ok := err.(interface{ StatusCode() int })
+				if !ok || coder.StatusCode() != tt.wantCode {
+					t.Errorf("Request.Bind() error = %v, want status %v", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Request.Bind() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_Codec(t *testing.T) {
+	app := New().Codec("application/json", JSONCodec{Options: JSONEncodeOptions{Prefix: "", Indent: "\t"}})
+	var bound map[string]interface{}
+	app.Post("/", func(req Request, res Response) {
+		// The replaced JSON codec binds leniently, without Request.JSON checks.
+		req.Bind(&bound)
+		res.Encode(bound)
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"a":1} trailing`))
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	var want bytes.Buffer
+	json.Indent(&want, []byte(`{"a":1}`), "", "\t")
+	if !reflect.DeepEqual(bound, map[string]interface{}{"a": 1.0}) || w.Body.String() != want.String() {
+		t.Errorf("App.Codec() bound %v, body %q", bound, w.Body)
+	}
+}
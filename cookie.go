@@ -2,13 +2,28 @@ package fastrex
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Cookie struct {
-	c http.Cookie
+	c           http.Cookie
+	partitioned bool
+	// explicit records the attributes set through setters, which the app cookie
+	// policy must not override.
+	explicit cookieAttr
 }
 
+type cookieAttr uint8
+
+const (
+	attrSecure cookieAttr = 1 << iota
+	attrHttpOnly
+	attrSameSite
+)
+
 func (k *Cookie) Domain(name string) *Cookie {
 	k.c.Domain = name
 	return k
@@ -65,6 +80,7 @@ func (k *Cookie) GetMaxAge() int {
 
 func (k *Cookie) HttpOnly(httpOnly bool) *Cookie {
 	k.c.HttpOnly = httpOnly
+	k.explicit |= attrHttpOnly
 	return k
 }
 
@@ -74,6 +90,7 @@ func (k *Cookie) GetHttpOnly() bool {
 
 func (k *Cookie) Secure(secure bool) *Cookie {
 	k.c.Secure = secure
+	k.explicit |= attrSecure
 	return k
 }
 
@@ -83,6 +100,7 @@ func (k *Cookie) GetSecure() bool {
 
 func (k *Cookie) SameSite(sameSite http.SameSite) *Cookie {
 	k.c.SameSite = sameSite
+	k.explicit |= attrSameSite
 	return k
 }
 
@@ -117,6 +135,192 @@ func (k *Cookie) GetUnparsed() []string {
 	return k.c.Unparsed
 }
 
-func (k *Cookie) cookie() *http.Cookie {
-	return &k.c
+// Partitioned sets the Partitioned attribute, which keys the cookie to the top-level
+// site in browsers that support CHIPS. Partitioned cookies must be Secure.
+func (k *Cookie) Partitioned(partitioned bool) *Cookie {
+	k.partitioned = partitioned
+	return k
+}
+
+func (k *Cookie) GetPartitioned() bool {
+	return k.partitioned
+}
+
+// String returns the Set-Cookie header value, or "" when the name is invalid.
+func (k *Cookie) String() string {
+	v := k.c.String()
+	if v != "" && k.partitioned {
+		v += "; Partitioned"
+	}
+	return v
+}
+
+// CookieError describes a cookie that was not sent because browsers would reject it.
+type CookieError struct {
+	Name   string
+	Reason string
+}
+
+func (e *CookieError) Error() string {
+	return "cookie error: " + strconv.Quote(e.Name) + ": " + e.Reason
+}
+
+// Validate checks the cookie against RFC 6265bis: name and value characters, the
+// 4096 byte limit, the __Secure- and __Host- prefixes and the attributes that
+// require Secure. Cookies that fail are dropped when the response is written.
+func (k *Cookie) Validate() error {
+	c := &k.c
+	fail := func(reason string) error {
+		return &CookieError{Name: c.Name, Reason: reason}
+	}
+	if c.Name == "" {
+		return fail("empty name")
+	}
+	for i := 0; i < len(c.Name); i++ {
+		if !isCookieNameByte(c.Name[i]) {
+			return fail("invalid character in name")
+		}
+	}
+	value := c.Value
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		if !isCookieValueByte(value[i]) {
+			return fail("invalid character in value")
+		}
+	}
+	if len(c.Name)+len(c.Value) > maxCookieSize {
+		return fail("name and value exceed " + strconv.Itoa(maxCookieSize) + " bytes")
+	}
+	if len(c.Path) > maxCookieAttrSize || len(c.Domain) > maxCookieAttrSize {
+		return fail("attribute exceeds " + strconv.Itoa(maxCookieAttrSize) + " bytes")
+	}
+
+	lower := strings.ToLower(c.Name)
+	switch {
+	case strings.HasPrefix(lower, "__secure-") && !c.Secure:
+		return fail("__Secure- prefix requires Secure")
+	case strings.HasPrefix(lower, "__host-") && (!c.Secure || c.Path != "/" || c.Domain != ""):
+		return fail("__Host- prefix requires Secure, Path=/ and no Domain")
+	case c.SameSite == http.SameSiteNoneMode && !c.Secure:
+		return fail("SameSite=None requires Secure")
+	case k.partitioned && !c.Secure:
+		return fail("Partitioned requires Secure")
+	}
+	return nil
+}
+
+const (
+	maxCookieSize     = 4096
+	maxCookieAttrSize = 1024
+)
+
+// isCookieNameByte reports whether b is a token character (RFC 7230 section 3.2.6).
+func isCookieNameByte(b byte) bool {
+	if b <= ' ' || b >= 0x7f {
+		return false
+	}
+	return strings.IndexByte(`()<>@,;:\"/[]?={}`, b) < 0
+}
+
+// isCookieValueByte reports whether b is a cookie-octet (RFC 6265 section 4.1.1).
+func isCookieValueByte(b byte) bool {
+	return b == 0x21 || (b >= 0x23 && b <= 0x2b) || (b >= 0x2d && b <= 0x3a) ||
+		(b >= 0x3c && b <= 0x5b) || (b >= 0x5d && b <= 0x7e)
+}
+
+// CookiePolicy holds the attributes applied to every cookie whose setter was not
+// called, see App.CookiePolicy.
+type CookiePolicy struct {
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+func (p *CookiePolicy) apply(k Cookie) Cookie {
+	if p == nil {
+		return k
+	}
+	if k.explicit&attrSecure == 0 && p.Secure {
+		k.c.Secure = true
+	}
+	if k.explicit&attrHttpOnly == 0 && p.HttpOnly {
+		k.c.HttpOnly = true
+	}
+	if k.explicit&attrSameSite == 0 && p.SameSite != 0 {
+		k.c.SameSite = p.SameSite
+	}
+	return k
+}
+
+// cookieJar collects the cookies of one response until the header is written.
+type cookieJar struct {
+	mu      sync.Mutex
+	cookies []Cookie
+	before  []func() error
+	written bool
+	// errs holds the cookies dropped by validation and the errors of the onWrite
+	// functions.
+	errs []error
+}
+
+// onWrite registers fn to run right before the cookies are written, while cookies
+// can still be added. Its error is kept with the cookie errors.
+func (j *cookieJar) onWrite(fn func() error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.before = append(j.before, fn)
+}
+
+// add queues c, replacing a queued cookie with the same name, path and domain.
+func (j *cookieJar) add(c Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, v := range j.cookies {
+		if v.c.Name == c.c.Name && v.c.Path == c.c.Path && v.c.Domain == c.c.Domain {
+			j.cookies[i] = c
+			return
+		}
+	}
+	j.cookies = append(j.cookies, c)
+}
+
+// write applies policy, validates and adds the queued cookies to header.
+func (j *cookieJar) write(header http.Header, policy *CookiePolicy) {
+	j.mu.Lock()
+	if j.written {
+		j.mu.Unlock()
+		return
+	}
+	j.written = true
+	before := j.before
+	j.before = nil
+	j.mu.Unlock()
+	var errs []error
+	for _, fn := range before {
+		if err := fn(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.errs = append(j.errs, errs...)
+	for i := range j.cookies {
+		c := policy.apply(j.cookies[i])
+		if err := c.Validate(); err != nil {
+			j.errs = append(j.errs, err)
+			continue
+		}
+		header.Add("Set-Cookie", c.String())
+	}
+}
+
+// errors returns the validation errors of the cookies dropped by write and the
+// errors of the onWrite functions.
+func (j *cookieJar) errors() []error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.errs
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -158,3 +159,56 @@ func TestCookie(t *testing.T) {
 		})
 	}
 }
+
+func TestCookie_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cookie  func(c *Cookie)
+		wantErr bool
+	}{
+		{name: "valid", cookie: func(c *Cookie) { c.Name("id").Value("abc") }},
+		{name: "quoted value", cookie: func(c *Cookie) { c.Name("id").Value(`"abc"`) }},
+		{name: "empty name", cookie: func(c *Cookie) { c.Value("abc") }, wantErr: true},
+		{name: "separator in name", cookie: func(c *Cookie) { c.Name("a;b").Value("abc") }, wantErr: true},
+		{name: "space in value", cookie: func(c *Cookie) { c.Name("id").Value("a b") }, wantErr: true},
+		{name: "too large", cookie: func(c *Cookie) { c.Name("id").Value(strings.Repeat("a", 4095)) }, wantErr: true},
+		{name: "secure prefix", cookie: func(c *Cookie) { c.Name("__Secure-id").Value("1") }, wantErr: true},
+		{name: "secure prefix with secure", cookie: func(c *Cookie) { c.Name("__Secure-id").Value("1").Secure(true) }},
+		{name: "host prefix with domain", cookie: func(c *Cookie) { c.Name("__Host-id").Value("1").Secure(true).Path("/").Domain("example.com") }, wantErr: true},
+		{name: "host prefix without path", cookie: func(c *Cookie) { c.Name("__host-id").Value("1").Secure(true) }, wantErr: true},
+		{name: "host prefix", cookie: func(c *Cookie) { c.Name("__Host-id").Value("1").Secure(true).Path("/") }},
+		{name: "samesite none", cookie: func(c *Cookie) { c.Name("id").Value("1").SameSite(http.SameSiteNoneMode) }, wantErr: true},
+		{name: "partitioned", cookie: func(c *Cookie) { c.Name("id").Value("1").Partitioned(true) }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Cookie{}
+			tt.cookie(&c)
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Cookie.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApp_CookiePolicy(t *testing.T) {
+	app := New().CookiePolicy(CookiePolicy{Secure: true, HttpOnly: true, SameSite: http.SameSiteNoneMode})
+	app.Get("/", func(req Request, res Response) {
+		a := Cookie{}
+		a.Name("a").Value("1").Partitioned(true)
+		b := Cookie{}
+		b.Name("b").Value("2").HttpOnly(false).SameSite(http.SameSiteStrictMode)
+		c := Cookie{}
+		c.Name("__Host-c").Value("3").Secure(false).Path("/")
+		res.Cookie(a).Cookie(b).Cookie(c).Send("ok")
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := []string{
+		"a=1; HttpOnly; Secure; SameSite=None; Partitioned",
+		"b=2; Secure; SameSite=Strict",
+	}
+	if got := w.Result().Header["Set-Cookie"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("App.CookiePolicy() Set-Cookie = %v, want %v", got, want)
+	}
+}
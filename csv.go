@@ -0,0 +1,305 @@
+package fastrex
+
+import (
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// codecField is an exported struct field as seen by the CSV and MessagePack codecs.
+type codecField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// codecFields lists the fields of t named by tag, then the json tag, then the field
+// name. Fields tagged "-" are skipped and embedded structs are flattened.
+func codecFields(t reflect.Type, tag string) []codecField {
+	fields := []codecField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		value, ok := sf.Tag.Lookup(tag)
+		if !ok {
+			value = sf.Tag.Get("json")
+		}
+		if value == "-" {
+			continue
+		}
+		parts := strings.Split(value, ",")
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && parts[0] == "" && ft.Kind() == reflect.Struct && sf.Type.Kind() != reflect.Ptr {
+			for _, f := range codecFields(ft, tag) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := codecField{name: sf.Name, index: []int{i}}
+		if parts[0] != "" {
+			f.name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// CSVCodec encodes slices of structs as CSV with a header row, and decodes such
+// CSV into a pointer to a slice of structs. Columns are named by the csv tag, then
+// the json tag. [][]string values are encoded and decoded as is.
+type CSVCodec struct{}
+
+// Encode ...
+func (CSVCodec) Encode(w io.Writer, v interface{}) error {
+	cw := csv.NewWriter(w)
+	if rows, ok := v.([][]string); ok {
+		return writeCSV(cw, rows)
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return errors.New("csv error: expected a slice of structs, got " + val.Kind().String())
+	}
+	elem := val.Type().Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return errors.New("csv error: expected a slice of structs, got a slice of " + elem.Kind().String())
+	}
+
+	fields := codecFields(elem, "csv")
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.name
+	}
+	rows := [][]string{header}
+	for i := 0; i < val.Len(); i++ {
+		item := val.Index(i)
+		if item.Kind() == reflect.Ptr {
+			if item.IsNil() {
+				continue
+			}
+			item = item.Elem()
+		}
+		row := make([]string, len(fields))
+		for j, f := range fields {
+			field, ok := fieldByIndex(item, f.index)
+			if !ok {
+				continue
+			}
+			s, err := formatCSVValue(field)
+			if err != nil {
+				return err
+			}
+			row[j] = s
+		}
+		rows = append(rows, row)
+	}
+	return writeCSV(cw, rows)
+}
+
+func writeCSV(cw *csv.Writer, rows [][]string) error {
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex that reports nil embedded pointers
+// instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func formatCSVValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// Decode ...
+func (CSVCodec) Decode(r io.Reader, v interface{}) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if rows, ok := v.(*[][]string); ok {
+		*rows = records
+		return nil
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Slice {
+		return errors.New("csv error: expected a pointer to a slice of structs")
+	}
+	slice := val.Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		return errors.New("csv error: expected a pointer to a slice of structs")
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	byName := map[string]codecField{}
+	for _, f := range codecFields(elem, "csv") {
+		byName[f.name] = f
+	}
+	columns := make([]*codecField, len(records[0]))
+	for i, name := range records[0] {
+		if f, ok := byName[name]; ok {
+			columns[i] = &f
+		}
+	}
+	for line, record := range records[1:] {
+		item := reflect.New(elem).Elem()
+		for i, s := range record {
+			if columns[i] == nil || s == "" {
+				continue
+			}
+			field := fieldByIndexAlloc(item, columns[i].index)
+			if err := setFromString(field, s); err != nil {
+				return fmt.Errorf("csv error: line %d, column %q: %v", line+2, columns[i].name, err)
+			}
+		}
+		if isPtr {
+			item = item.Addr()
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+	return nil
+}
+
+// fieldByIndexAlloc is reflect.Value.FieldByIndex that allocates nil embedded pointers.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// setFromString parses s into v according to its kind.
+func setFromString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return errors.New("unsupported type " + v.Type().String())
+		}
+		v.Set(reflect.ValueOf(s))
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package fastrex
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type csvBase struct {
+	ID int `csv:"id"`
+}
+
+type csvRow struct {
+	csvBase
+	Name    string    `json:"name"`
+	Price   float64   `csv:"price"`
+	Active  bool      `csv:"active"`
+	Created time.Time `csv:"created"`
+	Note    *string   `csv:"note"`
+	Secret  string    `csv:"-"`
+}
+
+func TestCSVCodec(t *testing.T) {
+	note := "a, \"quoted\" note"
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []*csvRow{
+		{csvBase: csvBase{1}, Name: "pen", Price: 1.5, Active: true, Created: created, Note: &note, Secret: "x"},
+		nil,
+		{csvBase: csvBase{2}, Name: "ink", Price: 20, Created: created},
+	}
+	want := "id,name,price,active,created,note\n" +
+		"1,pen,1.5,true,2024-01-02T03:04:05Z,\"a, \"\"quoted\"\" note\"\n" +
+		"2,ink,20,false,2024-01-02T03:04:05Z,\n"
+
+	buf := &bytes.Buffer{}
+	if err := (CSVCodec{}).Encode(buf, rows); err != nil {
+		t.Fatalf("CSVCodec.Encode() error = %v", err)
+	}
+	if buf.String() != want {
+		t.Errorf("CSVCodec.Encode() = %q, want %q", buf, want)
+	}
+
+	var got []csvRow
+	if err := (CSVCodec{}).Decode(strings.NewReader(want), &got); err != nil {
+		t.Fatalf("CSVCodec.Decode() error = %v", err)
+	}
+	wantRows := []csvRow{*rows[0], *rows[2]}
+	wantRows[0].Secret = ""
+	if !reflect.DeepEqual(got, wantRows) {
+		t.Errorf("CSVCodec.Decode() = %+v, want %+v", got, wantRows)
+	}
+}
+
+func TestCSVCodec_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode interface{}
+		decode string
+		target interface{}
+	}{
+		{name: "encode map", encode: map[string]int{"a": 1}},
+		{name: "encode slice of ints", encode: []int{1}},
+		{name: "decode into struct", decode: "id\n1\n", target: &csvRow{}},
+		{name: "decode bad number", decode: "id,price\n1,cheap\n", target: &[]csvRow{}},
+		{name: "decode ragged rows", decode: "id,name\n1\n", target: &[]csvRow{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.target == nil {
+				err = (CSVCodec{}).Encode(&bytes.Buffer{}, tt.encode)
+			} else {
+				err = (CSVCodec{}).Decode(strings.NewReader(tt.decode), tt.target)
+			}
+			if err == nil {
+				t.Errorf("CSVCodec error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package fastrex
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxDecompressedSize = 10 << 20
+
+// DecompressOptions configures the Decompress middleware.
+type DecompressOptions struct {
+	// MaxSize limits the decompressed body. Defaults to 10MB.
+	MaxSize int64
+}
+
+// Decompress returns a middleware that transparently decompresses gzip and deflate
+// request bodies before they reach the handler. Bodies that expand beyond MaxSize are
+// rejected with 413, unsupported encodings with 415.
+func Decompress(opts ...DecompressOptions) Middleware {
+	opt := DecompressOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.MaxSize <= 0 {
+		opt.MaxSize = defaultMaxDecompressedSize
+	}
+
+	return func(req Request, res Response, next Next) {
+		encodings := splitList(strings.ToLower(req.Header.Get("Content-Encoding")))
+		if len(encodings) == 0 || req.Body == nil {
+			next(req, res)
+			return
+		}
+
+		body, code, err := decompressBody(req.Body, encodings, opt.MaxSize)
+		req.Body.Close()
+		if err != nil {
+			next(req.ErrorMiddleware(err, code), res)
+			return
+		}
+
+		// Replace the body on the underlying request so every Request created
+		// for the rest of the chain sees the decompressed content.
+		rc := ioutil.NopCloser(bytes.NewReader(body))
+		req.r.Body = rc
+		req.r.ContentLength = int64(len(body))
+		req.r.Header.Del("Content-Encoding")
+		req.r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		req.Body = rc
+		req.ContentLength = int64(len(body))
+		next(req, res)
+	}
+}
+
+// decompressBody undoes the encodings in reverse order of application.
+func decompressBody(body io.Reader, encodings []string, max int64) ([]byte, int, error) {
+	r := body
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "identity":
+		case "gzip", "x-gzip":
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("decompress error: %v", err)
+			}
+			defer gz.Close()
+			r = gz
+		case "deflate":
+			fl, err := newDeflateReader(r)
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("decompress error: %v", err)
+			}
+			defer fl.Close()
+			r = fl
+		default:
+			return nil, http.StatusUnsupportedMediaType,
+				errors.New("decompress error: unsupported content encoding " + strconv.Quote(encodings[i]))
+		}
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("decompress error: %v", err)
+	}
+	if int64(len(data)) > max {
+		return nil, http.StatusRequestEntityTooLarge,
+			fmt.Errorf("decompress error: body exceeds %d bytes", max)
+	}
+	return data, 0, nil
+}
+
+// newDeflateReader accepts both zlib wrapped data, which is what the HTTP deflate
+// coding means, and the raw deflate streams some clients send instead.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	head := make([]byte, 2)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+	if n == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(r)
+	}
+	return flate.NewReader(r), nil
+}
@@ -0,0 +1,87 @@
+package fastrex
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compressBody(t *testing.T, encoding string, data string) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(buf)
+	case "deflate":
+		w = zlib.NewWriter(buf)
+	case "raw":
+		w, _ = flate.NewWriter(buf, flate.DefaultCompression)
+	default:
+		buf.WriteString(data)
+		return buf.Bytes()
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name       string
+		compress   string
+		encoding   string
+		body       string
+		opts       []DecompressOptions
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "plain", body: "hello", wantStatus: 200, wantBody: "hello"},
+		{name: "gzip", compress: "gzip", encoding: "gzip", body: "hello", wantStatus: 200, wantBody: "hello"},
+		{name: "deflate", compress: "deflate", encoding: "deflate", body: "hello", wantStatus: 200, wantBody: "hello"},
+		{name: "raw deflate", compress: "raw", encoding: "Deflate", body: "hello", wantStatus: 200, wantBody: "hello"},
+		{name: "identity", encoding: "identity", body: "hello", wantStatus: 200, wantBody: "hello"},
+		{name: "corrupt gzip", encoding: "gzip", body: "hello", wantStatus: 400},
+		{name: "unsupported", encoding: "br", body: "hello", wantStatus: 415},
+		{
+			name:       "bomb",
+			compress:   "gzip",
+			encoding:   "gzip",
+			body:       strings.Repeat("a", 1<<16),
+			opts:       []DecompressOptions{{MaxSize: 1024}},
+			wantStatus: 413,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New()
+			app.Use(Decompress(tt.opts...))
+			var got string
+			var encoding string
+			app.Post("/", func(req Request, res Response) {
+				b, _ := ioutil.ReadAll(req.Body)
+				got = string(b)
+				encoding = req.Header.Get("Content-Encoding")
+			})
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(compressBody(t, tt.compress, tt.body)))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Decompress() status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == 200 && (got != tt.wantBody || encoding != "") {
+				t.Errorf("Decompress() body = %q encoding = %q, want %q", got, encoding, tt.wantBody)
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"math"
 	"net/http"
 	"regexp"
+	"runtime/debug"
+	"sort"
 	"strings"
 )
 
@@ -32,6 +34,8 @@ type httpHandler struct {
 	moduleMiddlewares  map[string][]Middleware
 	template           *template.Template
 	moduleTemplate     map[string]*template.Template
+	injector           *injector
+	settings           settings
 }
 
 func (h *httpHandler) getModuleStaticFolderKey(url string, list map[string]string) string {
@@ -102,9 +106,12 @@ func (h *httpHandler) handleNotFoundRouteKey(w http.ResponseWriter, r *http.Requ
 		folder = "tmp"
 	}
 	if strings.HasSuffix(r.URL.Path, path) {
-		http.NotFound(w, r)
+		sendStatusError(w, h.settings.problems, http.StatusNotFound, "404 page not found")
 		return
 	}
+	if h.settings.problems {
+		w = &problemWriter{ResponseWriter: w}
+	}
 	fileHandler := http.FileServer(http.Dir(folder))
 	http.StripPrefix(path, fileHandler).ServeHTTP(w, r)
 }
@@ -116,22 +123,59 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.ctx != nil {
 		r = r.WithContext(h.ctx)
 	}
+	r = withState(r)
+	state := stateOf(r)
+	state.settings = &h.settings
+	if h.settings.problems {
+		defer h.recoverProblem(w, state)
+	}
 	key := h.getRouteKey(r.Method, r.URL.Path)
 	route, ok := h.routes[key]
+	if !ok && r.Method == http.MethodHead {
+		// HEAD is answered by the GET route; net/http drops the body.
+		route, ok = h.routes[h.getRouteKey(http.MethodGet, r.URL.Path)]
+	}
 	if !ok {
+		// Without problem details unmatched methods fall through to the static
+		// files, as they always did.
+		if allow := h.allowedMethods(r.URL.Path); h.settings.problems && len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			sendStatusError(w, true, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+			return
+		}
 		h.handleNotFoundRouteKey(w, r)
 		return
 	}
 
+	state.injector = h.injector
+	if route.injector != nil {
+		state.injector = route.injector
+	}
+	defer func() {
+		if err := state.scope.close(); err != nil && h.logger != nil {
+			h.logger.Println(err)
+		}
+	}()
+	defer func() {
+		// Handlers that never write still send the cookies they set.
+		if w != nil {
+			state.cookies.write(w.Header(), &h.settings.cookiePolicy)
+		}
+		if h.logger != nil {
+			for _, err := range state.cookies.errors() {
+				h.logger.Println(err)
+			}
+		}
+	}()
+	defer state.end()
+
 	if len(h.middlewares) > 0 ||
 		len(h.moduleMiddlewares) > 0 ||
 		len(route.middlewares) > 0 {
 		h.handleMiddleware(route, w, r)
 	} else if route.handler != nil {
-		route.handler(
-			*newRequest(r, h.routes, h.serverless, h.container),
-			newResponse(w, r, h.template, h.moduleTemplate),
-		)
+		req := newRequest(r, h.routes, h.serverless, h.container)
+		route.handler(*req, newResponse(w, req, h.template, h.moduleTemplate))
 	}
 }
 
@@ -183,8 +227,8 @@ func (h *httpHandler) loopMiddleware(
 		response Response
 	)
 	for i := range middlewares {
-		responseMid := newResponse(w, r, h.template, h.moduleTemplate)
 		requestMid := newRequest(r, h.routes, h.serverless, h.container)
+		responseMid := newResponse(w, requestMid, h.template, h.moduleTemplate)
 		middlewares[length-1-i](
 			*requestMid,
 			responseMid,
@@ -195,13 +239,58 @@ func (h *httpHandler) loopMiddleware(
 				e, ok := req.Context().Value(errMiddlewareKey).(ErrMiddleware)
 				if ok {
 					next = false
-					http.Error(w, e.Error.Error(), e.Code)
+					// The shared writer records the status and size for Response.
+					rw := responseMid.(*httpResponse).writer()
+					if h.settings.problems {
+						writeProblem(rw, toProblem(e.Error, e.Code))
+					} else {
+						http.Error(rw, e.Error.Error(), e.Code)
+					}
 				}
 			})
 	}
 	return next, request, response
 }
 
+// recoverProblem answers a panicking handler with a 500 problem, or aborts the
+// connection when the response has already started.
+func (h *httpHandler) recoverProblem(w http.ResponseWriter, state *requestState) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	if h.logger != nil {
+		h.logger.Printf("panic: %v\n%s", v, debug.Stack())
+	}
+	if state.writer != nil && state.writer.wroteHeader {
+		panic(http.ErrAbortHandler)
+	}
+	writeProblem(w, &Problem{Status: http.StatusInternalServerError})
+}
+
+// allowedMethods returns the methods of the routes matching path.
+func (h *httpHandler) allowedMethods(path string) []string {
+	var methods []string
+	for _, r := range h.routes {
+		if h.validate(r.path, path) {
+			methods = append(methods, r.method)
+			if r.method == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+			}
+		}
+	}
+	sort.Strings(methods)
+	for i := len(methods) - 1; i > 0; i-- {
+		if methods[i] == methods[i-1] {
+			methods = append(methods[:i], methods[i+1:]...)
+		}
+	}
+	return methods
+}
+
 func (h *httpHandler) getRouteKey(incomingMethod string, incomingPath string) string {
 	for _, r := range h.routes {
 		if incomingMethod == r.method && h.validate(r.path, incomingPath) {
@@ -284,5 +373,9 @@ func (f HandlerFunc) ServeHTTP(
 	template *template.Template,
 	moduleTemplate map[string]*template.Template,
 	container map[string]interface{}) {
-	f(*newRequest(r, route, true, container), newResponse(w, r, template, moduleTemplate))
+	req := newRequest(withState(r), route, true, container)
+	f(*req, newResponse(w, req, template, moduleTemplate))
+	if w != nil {
+		req.state.cookies.write(w.Header(), nil)
+	}
 }
@@ -0,0 +1,323 @@
+package fastrex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Lifetime controls how often a provider's factory is called.
+type Lifetime int
+
+const (
+	// Singleton factories run once per app; the instance is shared by every request.
+	Singleton Lifetime = iota
+	// Transient factories run every time the type is resolved.
+	Transient
+	// Scoped factories run once per request; the instance is disposed when the request ends.
+	Scoped
+)
+
+func (l Lifetime) String() string {
+	switch l {
+	case Singleton:
+		return "singleton"
+	case Transient:
+		return "transient"
+	case Scoped:
+		return "scoped"
+	}
+	return "unknown"
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+type provider struct {
+	lifetime Lifetime
+	fn       reflect.Value
+	out      reflect.Type
+	in       []reflect.Type
+	hasErr   bool
+
+	mu       sync.Mutex
+	created  bool
+	instance reflect.Value
+}
+
+// injector resolves dependencies by type. A module's injector has the app's
+// injector as parent, so module providers override the app's for module routes.
+type injector struct {
+	parent    *injector
+	providers map[reflect.Type]*provider
+
+	mu        sync.Mutex
+	disposers []io.Closer
+}
+
+func newInjector() *injector {
+	return &injector{providers: map[reflect.Type]*provider{}}
+}
+
+func newProvider(lifetime Lifetime, factory interface{}) (*provider, error) {
+	fn := reflect.ValueOf(factory)
+	if fn.Kind() != reflect.Func {
+		return nil, errors.New("provide error: factory must be a function")
+	}
+	t := fn.Type()
+	if t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return nil, fmt.Errorf("provide error: %v must return a value and an optional error", t)
+	}
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("provide error: %v must not be variadic", t)
+	}
+	p := &provider{
+		lifetime: lifetime,
+		fn:       fn,
+		out:      t.Out(0),
+		hasErr:   t.NumOut() == 2,
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		p.in = append(p.in, t.In(i))
+	}
+	return p, nil
+}
+
+func (in *injector) provide(lifetime Lifetime, factory interface{}) error {
+	p, err := newProvider(lifetime, factory)
+	if err != nil {
+		return err
+	}
+	in.providers[p.out] = p
+	return nil
+}
+
+func (in *injector) lookup(t reflect.Type) (*provider, *injector) {
+	for i := in; i != nil; i = i.parent {
+		if p, ok := i.providers[t]; ok {
+			return p, i
+		}
+	}
+	return nil, nil
+}
+
+// validate reports missing dependencies, cycles and singletons that depend on
+// scoped providers.
+func (in *injector) validate() error {
+	for _, p := range in.providers {
+		if err := in.check(p, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *injector) check(p *provider, path []reflect.Type) error {
+	for _, t := range path {
+		if t == p.out {
+			names := []string{}
+			for _, t := range append(path, p.out) {
+				names = append(names, t.String())
+			}
+			return errors.New("provide error: dependency cycle " + strings.Join(names, " -> "))
+		}
+	}
+	path = append(path, p.out)
+	for _, t := range p.in {
+		dep, owner := in.lookup(t)
+		if dep == nil {
+			return fmt.Errorf("provide error: no provider for %v required by %v", t, p.out)
+		}
+		if p.lifetime == Singleton && dep.lifetime == Scoped {
+			return fmt.Errorf("provide error: singleton %v depends on scoped %v", p.out, t)
+		}
+		if err := owner.check(dep, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns the instance of t. Shared reports whether it is being built for
+// a singleton, whose transient dependencies are then closed with the app.
+func (in *injector) resolve(t reflect.Type, s *scope, path []reflect.Type, shared bool) (reflect.Value, error) {
+	p, owner := in.lookup(t)
+	if p == nil {
+		return reflect.Value{}, fmt.Errorf("resolve error: no provider for %v", t)
+	}
+	for _, seen := range path {
+		if seen == t {
+			return reflect.Value{}, fmt.Errorf("resolve error: dependency cycle at %v", t)
+		}
+	}
+	path = append(path, t)
+
+	switch p.lifetime {
+	case Singleton:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.created {
+			return p.instance, nil
+		}
+		// Singletons resolve their dependencies where they were declared so a
+		// module override never leaks into an instance shared by the whole app.
+		v, err := owner.call(p, nil, path, true)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p.instance, p.created = v, true
+		owner.track(v)
+		return v, nil
+	case Scoped:
+		if s == nil {
+			return reflect.Value{}, fmt.Errorf("resolve error: scoped %v resolved outside a request", t)
+		}
+		if v, ok := s.get(p); ok {
+			return v, nil
+		}
+		v, err := in.call(p, s, path, false)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return s.put(p, v), nil
+	default:
+		v, err := in.call(p, s, path, shared)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		// A transient held by a singleton lives as long as the app. One resolved
+		// directly by App.Resolve belongs to the caller.
+		if s != nil {
+			s.track(v)
+		} else if shared {
+			owner.track(v)
+		}
+		return v, nil
+	}
+}
+
+func (in *injector) call(p *provider, s *scope, path []reflect.Type, shared bool) (reflect.Value, error) {
+	args := make([]reflect.Value, len(p.in))
+	for i, t := range p.in {
+		v, err := in.resolve(t, s, path, shared)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		args[i] = v
+	}
+	out := p.fn.Call(args)
+	if p.hasErr && !out[1].IsNil() {
+		return reflect.Value{}, out[1].Interface().(error)
+	}
+	return out[0], nil
+}
+
+// into resolves the type target points to and stores the instance in it.
+func (in *injector) into(target interface{}, s *scope) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("resolve error: target must be a non-nil pointer")
+	}
+	if in == nil {
+		return fmt.Errorf("resolve error: no provider for %v", v.Elem().Type())
+	}
+	instance, err := in.resolve(v.Elem().Type(), s, nil, false)
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(instance)
+	return nil
+}
+
+func (in *injector) track(v reflect.Value) {
+	if c, ok := closer(v); ok {
+		in.mu.Lock()
+		in.disposers = append(in.disposers, c)
+		in.mu.Unlock()
+	}
+}
+
+// dispose closes singletons in reverse creation order.
+func (in *injector) dispose() error {
+	in.mu.Lock()
+	disposers := in.disposers
+	in.disposers = nil
+	in.mu.Unlock()
+	return closeAll(disposers)
+}
+
+func closer(v reflect.Value) (io.Closer, bool) {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return nil, false
+		}
+	}
+	c, ok := v.Interface().(io.Closer)
+	return c, ok
+}
+
+func closeAll(disposers []io.Closer) error {
+	var first error
+	for i := len(disposers) - 1; i >= 0; i-- {
+		if err := disposers[i].Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// scope holds the scoped instances of one request.
+type scope struct {
+	mu        sync.Mutex
+	instances map[*provider]reflect.Value
+	disposers []io.Closer
+}
+
+func (s *scope) get(p *provider) (reflect.Value, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.instances[p]
+	return v, ok
+}
+
+// put stores v unless another goroutine of the same request stored one first.
+func (s *scope) put(p *provider, v reflect.Value) reflect.Value {
+	s.mu.Lock()
+	if existing, ok := s.instances[p]; ok {
+		s.mu.Unlock()
+		if c, ok := closer(v); ok {
+			c.Close()
+		}
+		return existing
+	}
+	if s.instances == nil {
+		s.instances = map[*provider]reflect.Value{}
+	}
+	s.instances[p] = v
+	s.mu.Unlock()
+	s.track(v)
+	return v
+}
+
+func (s *scope) track(v reflect.Value) {
+	if c, ok := closer(v); ok {
+		s.mu.Lock()
+		s.disposers = append(s.disposers, c)
+		s.mu.Unlock()
+	}
+}
+
+func (s *scope) close() error {
+	s.mu.Lock()
+	disposers := s.disposers
+	s.disposers = nil
+	s.instances = nil
+	s.mu.Unlock()
+	return closeAll(disposers)
+}
@@ -0,0 +1,228 @@
+package fastrex
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testConfig struct{ name string }
+
+type testDB struct {
+	cfg    *testConfig
+	closed bool
+}
+
+func (d *testDB) Close() error {
+	d.closed = true
+	return nil
+}
+
+type testRepo struct {
+	db     *testDB
+	closed bool
+}
+
+func (r *testRepo) Close() error {
+	r.closed = true
+	return nil
+}
+
+type testID struct{ n int }
+
+func TestApp_Provide(t *testing.T) {
+	count := 0
+	var repos []*testRepo
+	var db *testDB
+
+	app := New()
+	app.Provide(Singleton, func() *testConfig { return &testConfig{name: "app"} })
+	app.Provide(Singleton, func(c *testConfig) (*testDB, error) { return &testDB{cfg: c}, nil })
+	app.Provide(Scoped, func(db *testDB) *testRepo { return &testRepo{db: db} })
+	app.Provide(Transient, func() testID {
+		count++
+		return testID{count}
+	})
+	app.Get("/", func(req Request, res Response) {
+		var r1, r2 *testRepo
+		var id1, id2 testID
+		for _, target := range []interface{}{&r1, &r2, &id1, &id2} {
+			if err := req.Resolve(target); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if r1 != r2 {
+			t.Errorf("Request.Resolve() scoped instances differ within a request")
+		}
+		if id1 == id2 {
+			t.Errorf("Request.Resolve() transient instances are equal")
+		}
+		repos = append(repos, r1)
+		res.Send("")
+	})
+
+	for i := 0; i < 2; i++ {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if len(repos) != 2 || repos[0] == repos[1] {
+		t.Fatalf("Request.Resolve() scoped instance shared across requests")
+	}
+	if !repos[0].closed || !repos[1].closed {
+		t.Errorf("scoped instances were not disposed at the end of the request")
+	}
+	if repos[0].db != repos[1].db {
+		t.Errorf("singleton resolved twice")
+	}
+
+	if err := app.Resolve(&db); err != nil || db != repos[0].db {
+		t.Errorf("App.Resolve() = %v, %v", db, err)
+	}
+	var repo *testRepo
+	if err := app.Resolve(&repo); err == nil {
+		t.Errorf("App.Resolve() of a scoped provider outside a request should fail")
+	}
+
+	app.Shutdown(context.Background())
+	if !db.closed {
+		t.Errorf("App.Shutdown() did not dispose singletons")
+	}
+}
+
+func TestApp_Provide_validate(t *testing.T) {
+	type a struct{}
+	type b struct{}
+	tests := []struct {
+		name    string
+		setup   func(app App)
+		wantErr string
+	}{
+		{
+			name: "cycle",
+			setup: func(app App) {
+				app.Provide(Singleton, func(*b) *a { return &a{} })
+				app.Provide(Singleton, func(*a) *b { return &b{} })
+			},
+			wantErr: "dependency cycle",
+		},
+		{
+			name: "missing",
+			setup: func(app App) {
+				app.Provide(Singleton, func(*b) *a { return &a{} })
+			},
+			wantErr: "no provider for *fastrex.b",
+		},
+		{
+			name: "singleton depends on scoped",
+			setup: func(app App) {
+				app.Provide(Singleton, func(*b) *a { return &a{} })
+				app.Provide(Scoped, func() *b { return &b{} })
+			},
+			wantErr: "singleton *fastrex.a depends on scoped *fastrex.b",
+		},
+		{
+			name: "module",
+			setup: func(app App) {
+				app.Register(func(module App) App {
+					module.Provide(Singleton, func(*b) *a { return &a{} })
+					return module
+				}, "/admin")
+			},
+			wantErr: "no provider for *fastrex.b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New()
+			tt.setup(app)
+			err := app.Listen(0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("App.Listen() error = %v, want %v", err, tt.wantErr)
+			}
+
+			serverless := New()
+			tt.setup(serverless)
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				serverless.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+				if w.Code != 500 {
+					t.Errorf("App.ServeHTTP() status = %v, want 500", w.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestApp_Provide_disposeTransients(t *testing.T) {
+	app := New()
+	app.Provide(Transient, func() *testDB { return &testDB{} })
+	app.Provide(Singleton, func(db *testDB) *testRepo { return &testRepo{db: db} })
+
+	var db *testDB
+	var repo *testRepo
+	if err := app.Resolve(&db); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Resolve(&repo); err != nil {
+		t.Fatal(err)
+	}
+	app.Shutdown(context.Background())
+	if !repo.db.closed || !repo.closed {
+		t.Errorf("App.Shutdown() did not dispose a singleton and its transient dependency")
+	}
+	if db.closed {
+		t.Errorf("App.Shutdown() closed a transient owned by the App.Resolve caller")
+	}
+}
+
+func TestApp_Provide_invalidFactory(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("App.Provide() with a non-function did not panic")
+		}
+	}()
+	New().Provide(Singleton, "not a factory")
+}
+
+func TestApp_Provide_factoryError(t *testing.T) {
+	app := New()
+	app.Provide(Transient, func() (*testConfig, error) { return nil, errors.New("boom") })
+	var cfg *testConfig
+	if err := app.Resolve(&cfg); err == nil || err.Error() != "boom" {
+		t.Errorf("App.Resolve() error = %v, want boom", err)
+	}
+}
+
+func TestApp_Provide_module(t *testing.T) {
+	var got []string
+	handler := func(req Request, res Response) {
+		var cfg *testConfig
+		if err := req.Resolve(&cfg); err != nil {
+			t.Fatal(err)
+		}
+		var db *testDB
+		if err := req.Resolve(&db); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, cfg.name, db.cfg.name)
+	}
+	module := func(app App) App {
+		app.Provide(Singleton, func() *testConfig { return &testConfig{name: "module"} })
+		app.Get("/user", handler)
+		return app
+	}
+
+	app := New()
+	app.Provide(Singleton, func() *testConfig { return &testConfig{name: "app"} })
+	app.Provide(Singleton, func(c *testConfig) *testDB { return &testDB{cfg: c} })
+	app.Get("/", handler)
+	app.Register(module, "/api")
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/user", nil))
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	want := []string{"module", "app", "app", "app"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Request.Resolve() = %v, want %v", got, want)
+	}
+}
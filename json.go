@@ -0,0 +1,549 @@
+package fastrex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultJSONMaxBytes  = 1 << 20
+	defaultJSONMaxDepth  = 64
+	defaultJSONPCallback = "callback"
+	maxJSONPCallbackLen  = 128
+)
+
+// jsonpCallbackPattern accepts identifiers and dotted member access such as
+// "handle" or "app.callbacks.done".
+var jsonpCallbackPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// jsonNumberPattern is the JSON number grammar.
+var jsonNumberPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// JSONDecodeOptions controls Request.JSON. The zero value is strict: unknown fields
+// and data after the JSON value are rejected.
+type JSONDecodeOptions struct {
+	AllowUnknownFields bool
+	AllowTrailingData  bool
+	// UseNumber decodes numbers held in interface{} values as json.Number, which keeps
+	// their exact text instead of converting them to float64.
+	UseNumber bool
+	// AllowQuotedNumbers accepts numbers sent as strings, such as "42", for integer
+	// and float fields.
+	AllowQuotedNumbers bool
+	// MaxDepth limits the nesting of objects and arrays. Defaults to 64.
+	MaxDepth int
+	// MaxBytes limits the body size. Defaults to 1MB.
+	MaxBytes int64
+}
+
+// JSONEncodeOptions controls how Response.Json encodes values. The zero value
+// matches json.Marshal.
+type JSONEncodeOptions struct {
+	Prefix string
+	Indent string
+	// DisableHTMLEscape keeps <, > and & as is instead of escaping them to \u003c,
+	// \u003e and \u0026.
+	DisableHTMLEscape bool
+	// Marshal replaces encoding/json, for example with a faster compatible encoder.
+	// Prefix and Indent are still applied to its output.
+	Marshal func(v interface{}) ([]byte, error)
+	// JSONPCallback is the query parameter Response.Jsonp reads the callback name
+	// from. Defaults to "callback".
+	JSONPCallback string
+}
+
+func (o JSONEncodeOptions) marshal(v interface{}) ([]byte, error) {
+	if o.Marshal != nil {
+		data, err := o.Marshal(v)
+		if err != nil || (o.Prefix == "" && o.Indent == "") {
+			return data, err
+		}
+		buf := &bytes.Buffer{}
+		if err := json.Indent(buf, data, o.Prefix, o.Indent); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(!o.DisableHTMLEscape)
+	enc.SetIndent(o.Prefix, o.Indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Jsonp sends data wrapped in the callback named by the callback query parameter,
+// or plain JSON when there is none. Invalid callback names are rejected with 400.
+func (h *httpResponse) Jsonp(data interface{}) {
+	opts := h.jsonOptions()
+	param := opts.JSONPCallback
+	if param == "" {
+		param = defaultJSONPCallback
+	}
+	callback := h.r.URL.Query().Get(param)
+	if callback == "" {
+		h.Json(data)
+		return
+	}
+	if len(callback) > maxJSONPCallbackLen || !jsonpCallbackPattern.MatchString(callback) {
+		h.SendError(&statusError{code: http.StatusBadRequest, err: errors.New("invalid JSONP callback")})
+		return
+	}
+
+	body, err := opts.marshal(data)
+	if err != nil {
+		h.SendError(err)
+		return
+	}
+	// U+2028 and U+2029 are valid in JSON but end the line in older JavaScript engines.
+	body = bytes.ReplaceAll(body, []byte("\u2028"), []byte(`\u2028`))
+	body = bytes.ReplaceAll(body, []byte("\u2029"), []byte(`\u2029`))
+
+	h.writer().Header().Set(HeaderContentType, "text/javascript; charset=utf-8")
+	h.writer().Header().Set("X-Content-Type-Options", "nosniff")
+	if h.s != http.StatusOK {
+		h.writer().WriteHeader(h.s)
+	}
+	// The leading comment keeps the callback name from being the first bytes of the
+	// response, which blocks Flash based content sniffing attacks; typeof keeps a
+	// missing callback from raising an error.
+	js := "/**/ typeof " + callback + " === 'function' && " + callback + "(" + string(body) + ");"
+	_, err = h.writer().Write([]byte(js))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// statusError pairs an error with the status SendError should use.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+// StatusCode ...
+func (e *statusError) StatusCode() int {
+	return e.code
+}
+
+// JSONError describes why a JSON body could not be decoded. SendError renders it
+// with its status, 400 for malformed input.
+type JSONError struct {
+	Status  int    `json:"-"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Offset  int64  `json:"offset"`
+	Err     error  `json:"-"`
+}
+
+func (e *JSONError) Error() string {
+	return "json error: " + e.Message
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode ...
+func (e *JSONError) StatusCode() int {
+	return e.Status
+}
+
+// MarshalJSON ...
+func (e *JSONError) MarshalJSON() ([]byte, error) {
+	type body JSONError
+	return json.Marshal((*body)(e))
+}
+
+// JSON decodes the JSON request body into v. Failures are returned as *JSONError,
+// naming the offending field and byte offset where possible.
+func (h *Request) JSON(v interface{}, opts ...JSONDecodeOptions) error {
+	opt := JSONDecodeOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.MaxBytes <= 0 {
+		opt.MaxBytes = defaultJSONMaxBytes
+	}
+	if opt.MaxDepth <= 0 {
+		opt.MaxDepth = defaultJSONMaxDepth
+	}
+
+	if h.Header.Get(HeaderContentType) != "" && !h.Is("json", "+json") {
+		return &JSONError{Status: http.StatusUnsupportedMediaType, Message: "content type must be application/json"}
+	}
+	if h.Body == nil {
+		return &JSONError{Status: http.StatusBadRequest, Message: "request body is empty", Err: io.EOF}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(h.Body, opt.MaxBytes+1))
+	if err != nil {
+		return &JSONError{Status: http.StatusBadRequest, Message: "failed to read request body", Err: err}
+	}
+	if int64(len(data)) > opt.MaxBytes {
+		return &JSONError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("request body must not be larger than %d bytes", opt.MaxBytes),
+			Offset:  opt.MaxBytes,
+		}
+	}
+	if offset := exceedsDepth(data, opt.MaxDepth); offset >= 0 {
+		return &JSONError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("JSON nesting exceeds %d levels", opt.MaxDepth),
+			Offset:  offset,
+		}
+	}
+
+	scan := &jsonScan{unknown: !opt.AllowUnknownFields, quoted: opt.AllowQuotedNumbers}
+	if scan.unknown || scan.quoted {
+		if err := scan.run(data, reflect.TypeOf(v)); err != nil {
+			return err
+		}
+		data = scan.rewrite(data)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if !opt.AllowUnknownFields {
+		// The scan reports unknown fields with their path; this catches the ones
+		// it can not see, such as fields of structs held in interfaces.
+		dec.DisallowUnknownFields()
+	}
+	if opt.UseNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(v); err != nil {
+		return jsonDecodeError(err, data, scan.original(dec.InputOffset()), scan.original)
+	}
+	if !opt.AllowTrailingData {
+		if _, err := dec.Token(); err != io.EOF {
+			return &JSONError{
+				Status:  http.StatusBadRequest,
+				Message: "request body must contain a single JSON value",
+				Offset:  scan.original(dec.InputOffset()),
+			}
+		}
+	}
+	return nil
+}
+
+// exceedsDepth returns the offset where nesting first exceeds max, or -1.
+func exceedsDepth(data []byte, max int) int64 {
+	depth := 0
+	inString := false
+	escaped := false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				return int64(i)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return -1
+}
+
+// jsonDecodeError maps a decoding error to a *JSONError. original converts offsets
+// in data back to offsets in the request body.
+func jsonDecodeError(err error, data []byte, offset int64, original func(int64) int64) *JSONError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return &JSONError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("malformed JSON at offset %d", original(syntaxErr.Offset)),
+			Offset:  original(syntaxErr.Offset),
+			Err:     err,
+		}
+	case errors.As(err, &typeErr):
+		return &JSONError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("field %q must be %s, got %s", typeErr.Field, jsonKind(typeErr.Type), typeErr.Value),
+			Field:   typeErr.Field,
+			Offset:  original(typeErr.Offset),
+			Err:     err,
+		}
+	case errors.Is(err, io.EOF):
+		return &JSONError{Status: http.StatusBadRequest, Message: "request body is empty", Err: err}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &JSONError{Status: http.StatusBadRequest, Message: "malformed JSON: unexpected end of input", Offset: original(int64(len(data))), Err: err}
+	}
+	return &JSONError{Status: http.StatusBadRequest, Message: err.Error(), Offset: offset, Err: err}
+}
+
+// jsonScan walks a JSON document next to the Go type it is decoded into, before
+// encoding/json sees it. It reports unknown object keys with their path and offset,
+// and collects the quoted numbers sent for numeric fields so they can be unquoted.
+type jsonScan struct {
+	unknown bool
+	quoted  bool
+	data    []byte
+	dec     *json.Decoder
+	edits   []jsonEdit
+}
+
+// jsonEdit replaces data[start:end], a quoted number, with text.
+type jsonEdit struct {
+	start, end int64
+	text       string
+}
+
+// errJSONScanStop ends a scan at input it can not follow. The decoder reports it.
+var errJSONScanStop = errors.New("json scan stopped")
+
+func (s *jsonScan) run(data []byte, t reflect.Type) error {
+	s.data = data
+	s.dec = json.NewDecoder(bytes.NewReader(data))
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if err := s.value(t, ""); err != nil && err != errJSONScanStop {
+		return err
+	}
+	return nil
+}
+
+// next returns the offset of the next token.
+func (s *jsonScan) next() int64 {
+	i := s.dec.InputOffset()
+	for i < int64(len(s.data)) && strings.IndexByte(" \t\r\n,:", s.data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// value scans one value decoded into t, or into an unknown type when t is nil.
+func (s *jsonScan) value(t reflect.Type, path string) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && (t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(jsonUnmarshalerType)) {
+		t = nil
+	}
+	start := s.next()
+	tok, err := s.dec.Token()
+	if err != nil {
+		return errJSONScanStop
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok == '[' {
+			var elem reflect.Type
+			if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+				elem = t.Elem()
+			}
+			for s.dec.More() {
+				if err := s.value(elem, path); err != nil {
+					return err
+				}
+			}
+		} else {
+			for s.dec.More() {
+				if err := s.member(t, path); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := s.dec.Token(); err != nil {
+			return errJSONScanStop
+		}
+	case string:
+		if s.quoted && t != nil && isNumberKind(t.Kind()) && jsonNumberPattern.MatchString(tok) {
+			s.edits = append(s.edits, jsonEdit{start: start, end: s.dec.InputOffset(), text: tok})
+		}
+	}
+	return nil
+}
+
+// member scans one key and value of an object decoded into t.
+func (s *jsonScan) member(t reflect.Type, path string) error {
+	start := s.next()
+	tok, err := s.dec.Token()
+	if err != nil {
+		return errJSONScanStop
+	}
+	key, _ := tok.(string)
+	var elem reflect.Type
+	switch {
+	case t == nil:
+	case t.Kind() == reflect.Map:
+		elem = t.Elem()
+	case t.Kind() == reflect.Struct:
+		name := key
+		if path != "" {
+			name = path + "." + key
+		}
+		f, ok := jsonFieldByName(t, key)
+		if !ok && s.unknown {
+			return &JSONError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("unknown field %q", name),
+				Field:   name,
+				Offset:  start,
+			}
+		}
+		if ok && !f.quoted {
+			elem = f.typ
+		}
+		path = name
+	}
+	return s.value(elem, path)
+}
+
+// rewrite returns data with the collected quoted numbers unquoted.
+func (s *jsonScan) rewrite(data []byte) []byte {
+	if len(s.edits) == 0 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	last := int64(0)
+	for _, e := range s.edits {
+		out = append(out, data[last:e.start]...)
+		out = append(out, e.text...)
+		last = e.end
+	}
+	return append(out, data[last:]...)
+}
+
+// original converts an offset in the rewritten data to one in the request body.
+func (s *jsonScan) original(offset int64) int64 {
+	for _, e := range s.edits {
+		if offset <= e.start {
+			break
+		}
+		offset += e.end - e.start - int64(len(e.text))
+	}
+	return offset
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// jsonField is a struct field as encoding/json decodes it.
+type jsonField struct {
+	name   string
+	typ    reflect.Type
+	quoted bool
+}
+
+// jsonFields lists the fields of t encoding/json decodes into, with the fields of
+// embedded structs after the ones declared in t, which hide them.
+func jsonFields(t reflect.Type, depth int) []jsonField {
+	var fields, embedded []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		if sf.Anonymous && parts[0] == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if depth < defaultJSONMaxDepth {
+					embedded = append(embedded, jsonFields(ft, depth+1)...)
+				}
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := jsonField{name: sf.Name, typ: sf.Type}
+		if parts[0] != "" {
+			f.name = parts[0]
+		}
+		for _, opt := range parts[1:] {
+			if opt == "string" {
+				f.quoted = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return append(fields, embedded...)
+}
+
+// jsonFieldByName finds the field key decodes into: an exact match first, then a
+// case-insensitive one, like encoding/json.
+func jsonFieldByName(t reflect.Type, key string) (jsonField, bool) {
+	fields := jsonFields(t, 0)
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// jsonKind names a Go type the way a JSON client thinks about it.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Ptr:
+		return jsonKind(t.Elem())
+	}
+	return "a " + t.String()
+}
@@ -0,0 +1,252 @@
+package fastrex
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jsonAddress struct {
+	City string `json:"city"`
+}
+
+type jsonUser struct {
+	Name    string      `json:"name"`
+	Age     int         `json:"age"`
+	Address jsonAddress `json:"address"`
+	Extra   interface{} `json:"extra"`
+}
+
+func TestRequest_JSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		opts        []JSONDecodeOptions
+		wantStatus  int
+		wantField   string
+		wantOffset  int64
+		wantMessage string
+	}{
+		{name: "valid", body: `{"name":"agus","age":30,"address":{"city":"Jakarta"}}`},
+		{name: "empty", body: ``, wantStatus: 400, wantMessage: "request body is empty"},
+		{name: "syntax", body: `{"name":"agus",}`, wantStatus: 400, wantOffset: 16, wantMessage: "malformed JSON at offset 16"},
+		{name: "unexpected end", body: `{"name":`, wantStatus: 400, wantMessage: "malformed JSON: unexpected end of input", wantOffset: 8},
+		{
+			name:        "type",
+			body:        `{"address":{"city":12}}`,
+			wantStatus:  400,
+			wantField:   "address.city",
+			wantOffset:  21,
+			wantMessage: `field "address.city" must be a string, got number`,
+		},
+		{name: "unknown field", body: `{"nama":"agus"}`, wantStatus: 400, wantField: "nama", wantMessage: `unknown field "nama"`, wantOffset: 1},
+		{
+			name:        "unknown nested field",
+			body:        `{"extra":{"nama":1},"address":{"nama":"x"}}`,
+			wantStatus:  400,
+			wantField:   "address.nama",
+			wantOffset:  31,
+			wantMessage: `unknown field "address.nama"`,
+		},
+		{name: "case-insensitive field", body: `{"NAME":"agus","Address":{"City":"Jakarta"}}`},
+		{name: "quoted number rejected", body: `{"age":"42"}`, wantStatus: 400, wantField: "age", wantOffset: 11, wantMessage: `field "age" must be an integer, got string`},
+		{name: "quoted number", body: `{"age":"42"}`, opts: []JSONDecodeOptions{{AllowQuotedNumbers: true}}},
+		{
+			name:        "quoted number offsets",
+			body:        `{"age":"42","address":{"city":12}}`,
+			opts:        []JSONDecodeOptions{{AllowQuotedNumbers: true}},
+			wantStatus:  400,
+			wantField:   "address.city",
+			wantOffset:  32,
+			wantMessage: `field "address.city" must be a string, got number`,
+		},
+		{
+			name:        "quoted text for a number",
+			body:        `{"age":"old"}`,
+			opts:        []JSONDecodeOptions{{AllowQuotedNumbers: true}},
+			wantStatus:  400,
+			wantField:   "age",
+			wantOffset:  12,
+			wantMessage: `field "age" must be an integer, got string`,
+		},
+		{name: "unknown field allowed", body: `{"nama":"agus"}`, opts: []JSONDecodeOptions{{AllowUnknownFields: true}}},
+		{name: "trailing data", body: `{"name":"agus"} {"name":"budi"}`, wantStatus: 400, wantMessage: "request body must contain a single JSON value", wantOffset: 17},
+		{name: "trailing data allowed", body: `{"name":"agus"} {}`, opts: []JSONDecodeOptions{{AllowTrailingData: true}}},
+		{name: "too deep", body: `{"extra":[[[1]]]}`, opts: []JSONDecodeOptions{{MaxDepth: 3}}, wantStatus: 400, wantOffset: 11, wantMessage: "JSON nesting exceeds 3 levels"},
+		{name: "string brackets ignored", body: `{"name":"[[[[{"}`, opts: []JSONDecodeOptions{{MaxDepth: 1}}},
+		{name: "too large", body: `{"name":"agus"}`, opts: []JSONDecodeOptions{{MaxBytes: 4}}, wantStatus: 413, wantOffset: 4, wantMessage: "request body must not be larger than 4 bytes"},
+		{name: "wrong content type", body: `{}`, contentType: "text/plain", wantStatus: 415, wantMessage: "content type must be application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.contentType == "" {
+				tt.contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", tt.contentType)
+			h := newRequest(req, nil, false, nil)
+			var user jsonUser
+			err := h.JSON(&user, tt.opts...)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Errorf("Request.JSON() error = %v", err)
+				}
+				return
+			}
+			var je *JSONError
+			if !errors.As(err, &je) {
+				t.Fatalf("Request.JSON() error = %v, want *JSONError", err)
+			}
+			if je.StatusCode() != tt.wantStatus || je.Field != tt.wantField || je.Offset != tt.wantOffset || je.Message != tt.wantMessage {
+				t.Errorf("Request.JSON() = %d %q %d %q, want status %v field %q offset %v message %q",
+					je.Status, je.Field, je.Offset, je.Message, tt.wantStatus, tt.wantField, tt.wantOffset, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRequest_JSON_useNumber(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"extra":12345678901234567890}`))
+	h := newRequest(req, nil, false, nil)
+	var user jsonUser
+	if err := h.JSON(&user, JSONDecodeOptions{UseNumber: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := user.Extra.(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Errorf("Request.JSON() extra = %#v, want json.Number", user.Extra)
+	}
+}
+
+func TestRequest_JSON_quotedNumbers(t *testing.T) {
+	type base struct {
+		ID uint `json:"id"`
+	}
+	type item struct {
+		base
+		Price  float64            `json:"price"`
+		Counts []int              `json:"counts"`
+		Scores map[string]float32 `json:"scores"`
+		Code   string             `json:"code"`
+		Legacy int                `json:"legacy,string"`
+	}
+	body := `{"id":"7","price":"9.5","counts":["1",2],"scores":{"a":"-1e2"},"code":"42","legacy":"3"}`
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	h := newRequest(req, nil, false, nil)
+	var got item
+	if err := h.JSON(&got, JSONDecodeOptions{AllowQuotedNumbers: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != 7 || got.Price != 9.5 || len(got.Counts) != 2 || got.Counts[0] != 1 ||
+		got.Scores["a"] != -100 || got.Code != "42" || got.Legacy != 3 {
+		t.Errorf("Request.JSON() = %+v", got)
+	}
+}
+
+func Test_httpResponse_SendError_json(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"age":"old"}`))
+	w := httptest.NewRecorder()
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		var user jsonUser
+		if err := r1.JSON(&user); err != nil {
+			r2.SendError(err)
+		}
+	}
+	handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	want := `{"message":"field \"age\" must be an integer, got string","field":"age","offset":12}`
+	if resp.StatusCode != 400 || string(body) != want {
+		t.Errorf("Response.SendError() = %v %v, want 400 %v", resp.StatusCode, string(body), want)
+	}
+}
+
+func TestApp_JSONEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		opts JSONEncodeOptions
+		want string
+	}{
+		{name: "default", want: `{"a":"\u003cb\u003e"}`},
+		{name: "html escape disabled", opts: JSONEncodeOptions{DisableHTMLEscape: true}, want: `{"a":"<b>"}`},
+		{name: "indent", opts: JSONEncodeOptions{Indent: "  ", DisableHTMLEscape: true}, want: "{\n  \"a\": \"<b>\"\n}"},
+		{
+			name: "custom marshal",
+			opts: JSONEncodeOptions{
+				Indent:  " ",
+				Marshal: func(v interface{}) ([]byte, error) { return []byte(`{"custom":true}`), nil },
+			},
+			want: "{\n \"custom\": true\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New()
+			app.JSONEncoding(tt.opts)
+			app.Get("/", func(req Request, res Response) {
+				res.Json(map[string]string{"a": "<b>"})
+			})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("Response.Json() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResponse_Jsonp(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		opts       JSONEncodeOptions
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{
+			name:       "callback",
+			url:        "/?callback=app.done",
+			wantStatus: 200,
+			wantType:   "text/javascript; charset=utf-8",
+			wantBody:   "/**/ typeof app.done === 'function' && app.done({\"line\":\"a\\u2028b\"});",
+		},
+		{
+			name:       "custom parameter",
+			url:        "/?cb=done&callback=ignored",
+			opts:       JSONEncodeOptions{JSONPCallback: "cb"},
+			wantStatus: 200,
+			wantType:   "text/javascript; charset=utf-8",
+			wantBody:   "/**/ typeof done === 'function' && done({\"line\":\"a\\u2028b\"});",
+		},
+		{name: "no callback", url: "/", wantStatus: 200, wantType: "application/json", wantBody: "{\"line\":\"a\\u2028b\"}"},
+		{
+			name:       "unsafe callback",
+			url:        "/?callback=alert(1)//",
+			wantStatus: 400,
+			wantType:   "application/json",
+			wantBody:   `{"message":"invalid JSONP callback"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New().JSONEncoding(tt.opts)
+			app.Get("/", func(req Request, res Response) {
+				res.Jsonp(map[string]string{"line": "a b"})
+			})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			if w.Code != tt.wantStatus || w.Header().Get(HeaderContentType) != tt.wantType || w.Body.String() != tt.wantBody {
+				t.Errorf("Response.Jsonp() = %v %v %q, want %v %v %q",
+					w.Code, w.Header().Get(HeaderContentType), w.Body.String(), tt.wantStatus, tt.wantType, tt.wantBody)
+			}
+			if tt.wantType == "text/javascript; charset=utf-8" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("Response.Jsonp() missing nosniff")
+			}
+		})
+	}
+}
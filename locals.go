@@ -0,0 +1,122 @@
+package fastrex
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const stateKey = routerKey("state")
+
+// Locals holds values scoped to a single request. It is safe for concurrent use.
+type Locals struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+// Get returns the value stored under key, or nil.
+func (l *Locals) Get(key string) interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.values[key]
+}
+
+// Set stores value under key.
+func (l *Locals) Set(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.values == nil {
+		l.values = map[string]interface{}{}
+	}
+	l.values[key] = value
+}
+
+// Delete removes the value stored under key.
+func (l *Locals) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.values, key)
+}
+
+// All returns a copy of every stored value.
+func (l *Locals) All() map[string]interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	all := make(map[string]interface{}, len(l.values))
+	for k, v := range l.values {
+		all[k] = v
+	}
+	return all
+}
+
+// requestState is shared by every Request and Response created for one incoming request.
+type requestState struct {
+	locals   Locals
+	injector *injector
+	scope    scope
+	settings *settings
+	cookies  cookieJar
+	session  *Session
+	writer   *responseWriter
+
+	mu   sync.Mutex
+	ends []func()
+}
+
+// onEnd registers fn to run when the route handler returns.
+func (s *requestState) onEnd(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ends = append(s.ends, fn)
+}
+
+// end runs the functions registered with onEnd, last registered first.
+func (s *requestState) end() {
+	s.mu.Lock()
+	ends := s.ends
+	s.ends = nil
+	s.mu.Unlock()
+	for i := len(ends) - 1; i >= 0; i-- {
+		ends[i]()
+	}
+}
+
+// writeCookies adds the queued cookies to header under the app cookie policy.
+func (s *requestState) writeCookies(header http.Header) {
+	var policy *CookiePolicy
+	if s.settings != nil {
+		policy = &s.settings.cookiePolicy
+	}
+	s.cookies.write(header, policy)
+}
+
+func stateFromContext(ctx context.Context) *requestState {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(stateKey).(*requestState)
+	return s
+}
+
+// withState attaches a fresh request state to r unless it already carries one.
+func withState(r *http.Request) *http.Request {
+	if stateFromContext(r.Context()) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), stateKey, &requestState{}))
+}
+
+// keepState makes sure a context replacing the request's context keeps its state.
+func keepState(ctx context.Context, s *requestState) context.Context {
+	if s == nil || stateFromContext(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, stateKey, s)
+}
+
+func stateOf(r *http.Request) *requestState {
+	if s := stateFromContext(r.Context()); s != nil {
+		return s
+	}
+	return &requestState{}
+}
@@ -0,0 +1,96 @@
+package fastrex
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLocals(t *testing.T) {
+	l := &Locals{}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l.Set("key", i)
+			l.Get("key")
+			l.All()
+		}(i)
+	}
+	wg.Wait()
+	l.Set("name", "agus")
+	l.Delete("key")
+	if got := l.All(); len(got) != 1 || got["name"] != "agus" {
+		t.Errorf("Locals.All() = %v, want map[name:agus]", got)
+	}
+}
+
+func TestRequest_Set(t *testing.T) {
+	var got []interface{}
+	app := New()
+	app.Add("db", "postgres")
+	app.Use(func(req Request, res Response, next Next) {
+		if req.Get("user") != nil {
+			t.Errorf("Request.Get() leaked a value from a previous request")
+		}
+		req.Set("user", req.URL.Path)
+		next(req, res)
+	})
+	app.Get("/:name", func(req Request, res Response) {
+		got = append(got, req.Get("user"), res.Locals().Get("user"), req.GetDependency("db"))
+		res.Send("")
+	})
+
+	for _, path := range []string{"/agus", "/budi"} {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	}
+
+	want := []interface{}{"/agus", "/agus", "postgres", "/budi", "/budi", "postgres"}
+	if len(got) != len(want) {
+		t.Fatalf("Request.Get() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Request.Get() = %v, want %v", got, want)
+			break
+		}
+	}
+	if got := app.Dependency("user"); got != nil {
+		t.Errorf("App.Dependency() = %v, want nil", got)
+	}
+}
+
+func TestApp_Add_afterStart(t *testing.T) {
+	app := New()
+	app.Get("/", func(req Request, res Response) {})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	defer func() {
+		if recover() == nil {
+			t.Errorf("App.Add() after start did not panic")
+		}
+	}()
+	app.Add("late", 1)
+}
+
+func Test_httpResponse_Render_locals(t *testing.T) {
+	tmpl := template.Must(template.New("page").Parse(`{{.user}} {{.title}}`))
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		r1.Set("user", "agus").Set("title", "ignored")
+		err := r2.Render(map[string]interface{}{"title": "home"})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	handler.ServeHTTP(w, req, nil, tmpl, nil, map[string]interface{}{})
+
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	if got := string(body); got != "agus home" {
+		t.Errorf("Response.Render() = %v, want %v", got, "agus home")
+	}
+}
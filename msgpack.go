@@ -0,0 +1,574 @@
+package fastrex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const maxMsgpackDepth = 100
+
+var errMsgpackShort = errors.New("msgpack error: unexpected end of data")
+
+// MsgpackCodec encodes and decodes MessagePack. Structs are maps keyed by the
+// msgpack tag, then the json tag, and time.Time is an RFC 3339 string. Extension
+// types are not supported.
+type MsgpackCodec struct{}
+
+// Encode ...
+func (MsgpackCodec) Encode(w io.Writer, v interface{}) error {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return err
+	}
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Decode ...
+func (MsgpackCodec) Decode(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("msgpack error: Decode needs a non-nil pointer")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d := &msgpackDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("msgpack error: data after the top-level value")
+	}
+	return assignDecoded(rv.Elem(), value)
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value, depth int) error {
+	if depth > maxMsgpackDepth {
+		return errors.New("msgpack error: value nested too deeply")
+	}
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if v.Type() == timeType {
+		e.encodeString(v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		return e.encode(v.Elem(), depth+1)
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = appendUint32(e.buf, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = appendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.encodeBytes(b)
+			return nil
+		}
+		e.encodeHeader(v.Len(), 0x90, 0xdc, 0xdd, 16)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		e.encodeHeader(len(keys), 0x80, 0xde, 0xdf, 16)
+		for _, k := range keys {
+			if err := e.encode(k, depth+1); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(k), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		type member struct {
+			name  string
+			value reflect.Value
+		}
+		members := []member{}
+		for _, f := range codecFields(v.Type(), "msgpack") {
+			field, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(field)) {
+				continue
+			}
+			members = append(members, member{f.name, field})
+		}
+		e.encodeHeader(len(members), 0x80, 0xde, 0xdf, 16)
+		for _, m := range members {
+			e.encodeString(m.name)
+			if err := e.encode(m.value, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("msgpack error: unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = appendUint64(e.buf, uint64(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n < 0x80:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = appendUint16(e.buf, uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = appendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = appendUint64(e.buf, n)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// encodeHeader writes an array or map header: the fix form for n below fixMax, then
+// the 16 and 32 bit forms.
+func (e *msgpackEncoder) encodeHeader(n int, fix, code16, code32 byte, fixMax int) {
+	switch {
+	case n < fixMax:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, code16)
+		e.buf = appendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, code32)
+		e.buf = appendUint32(e.buf, uint32(n))
+	}
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+// msgpackDecoder decodes into nil, bool, int64, uint64, float64, string, []byte,
+// []interface{} and map[string]interface{}. Map keys that are not strings are
+// formatted with fmt.Sprint.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errors.New("msgpack error: value nested too deeply")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), raw...), nil
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0:
+		n, err := d.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := d.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := d.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := d.uint(8)
+		return int64(n), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack error: unsupported type byte 0x%02x", c)
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n int, depth int) (interface{}, error) {
+	// Every element takes at least one byte, which bounds the allocation.
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int, depth int) (interface{}, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, errMsgpackShort
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// assignDecoded stores a value produced by msgpackDecoder in dst, converting it to
+// the type of dst.
+func assignDecoded(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	mismatch := func() error {
+		return fmt.Errorf("msgpack error: can not decode %T into %s", src, dst.Type())
+	}
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignDecoded(dst.Elem(), src)
+	}
+	if dst.Type() == timeType {
+		s, ok := src.(string)
+		if !ok {
+			return mismatch()
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(src))
+	case reflect.Bool:
+		b, ok := src.(bool)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch s := src.(type) {
+		case int64:
+			n = s
+		case uint64:
+			if s > math.MaxInt64 {
+				return mismatch()
+			}
+			n = int64(s)
+		default:
+			return mismatch()
+		}
+		if dst.OverflowInt(n) {
+			return mismatch()
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch s := src.(type) {
+		case uint64:
+			n = s
+		case int64:
+			if s < 0 {
+				return mismatch()
+			}
+			n = uint64(s)
+		default:
+			return mismatch()
+		}
+		if dst.OverflowUint(n) {
+			return mismatch()
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch s := src.(type) {
+		case float64:
+			dst.SetFloat(s)
+		case int64:
+			dst.SetFloat(float64(s))
+		case uint64:
+			dst.SetFloat(float64(s))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		switch s := src.(type) {
+		case string:
+			dst.SetString(s)
+		case []byte:
+			dst.SetString(string(s))
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch s := src.(type) {
+			case []byte:
+				dst.SetBytes(s)
+				return nil
+			case string:
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+		}
+		items, ok := src.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignDecoded(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		items, ok := src.([]interface{})
+		if !ok || len(items) != dst.Len() {
+			return mismatch()
+		}
+		for i, item := range items {
+			if err := assignDecoded(dst.Index(i), item); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := src.(map[string]interface{})
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, item := range m {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignDecoded(value, item); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), value)
+		}
+		dst.Set(out)
+	case reflect.Struct:
+		m, ok := src.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range codecFields(dst.Type(), "msgpack") {
+			item, ok := m[f.name]
+			if !ok {
+				continue
+			}
+			if err := assignDecoded(fieldByIndexAlloc(dst, f.index), item); err != nil {
+				return err
+			}
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
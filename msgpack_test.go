@@ -0,0 +1,121 @@
+package fastrex
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpackCodec_Encode(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{name: "nil", v: nil, want: []byte{0xc0}},
+		{name: "bools", v: []bool{true, false}, want: []byte{0x92, 0xc3, 0xc2}},
+		{name: "positive fixint", v: 127, want: []byte{0x7f}},
+		{name: "negative fixint", v: -32, want: []byte{0xe0}},
+		{name: "int8", v: -33, want: []byte{0xd0, 0xdf}},
+		{name: "uint8", v: 200, want: []byte{0xcc, 0xc8}},
+		{name: "int16", v: -1000, want: []byte{0xd1, 0xfc, 0x18}},
+		{name: "uint32", v: uint32(70000), want: []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{name: "int64", v: int64(math.MinInt64), want: []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "float32", v: float32(1.5), want: []byte{0xca, 0x3f, 0xc0, 0, 0}},
+		{name: "float64", v: 1.5, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{name: "fixstr", v: "hi", want: []byte{0xa2, 'h', 'i'}},
+		{name: "str8", v: strings.Repeat("a", 32), want: append([]byte{0xd9, 32}, strings.Repeat("a", 32)...)},
+		{name: "bin8", v: []byte{1, 2}, want: []byte{0xc4, 2, 1, 2}},
+		{name: "sorted map", v: map[string]int{"b": 2, "a": 1}, want: []byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}},
+		{
+			name: "struct tags",
+			v: struct {
+				A    int    `msgpack:"a"`
+				B    string `json:"b,omitempty"`
+				Skip int    `msgpack:"-"`
+				c    int
+			}{A: 1, Skip: 2, c: 3},
+			want: []byte{0x81, 0xa1, 'a', 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			if err := (MsgpackCodec{}).Encode(buf, tt.v); err != nil {
+				t.Fatalf("MsgpackCodec.Encode() error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("MsgpackCodec.Encode() = % x, want % x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackCodec_roundTrip(t *testing.T) {
+	type inner struct {
+		Tags []string `msgpack:"tags"`
+	}
+	type record struct {
+		ID      uint64            `msgpack:"id"`
+		Score   float64           `msgpack:"score"`
+		Delta   int16             `msgpack:"delta"`
+		Name    string            `msgpack:"name"`
+		Data    []byte            `msgpack:"data"`
+		At      time.Time         `msgpack:"at"`
+		Labels  map[string]string `msgpack:"labels"`
+		Inner   *inner            `msgpack:"inner"`
+		Any     interface{}       `msgpack:"any"`
+		Missing *int              `msgpack:"missing"`
+		inner
+	}
+	in := record{
+		ID:     math.MaxUint64,
+		Score:  -2.25,
+		Delta:  -300,
+		Name:   strings.Repeat("x", 300),
+		Data:   bytes.Repeat([]byte{7}, 70000),
+		At:     time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		Labels: map[string]string{"env": "prod"},
+		Inner:  &inner{Tags: []string{"a", "b"}},
+		Any:    []interface{}{int64(1), "two", map[string]interface{}{"three": true}},
+		inner:  inner{Tags: []string{"embedded"}},
+	}
+	buf := &bytes.Buffer{}
+	if err := (MsgpackCodec{}).Encode(buf, in); err != nil {
+		t.Fatalf("MsgpackCodec.Encode() error = %v", err)
+	}
+	var out record
+	if err := (MsgpackCodec{}).Decode(buf, &out); err != nil {
+		t.Fatalf("MsgpackCodec.Decode() error = %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("MsgpackCodec round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestMsgpackCodec_Decode_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		v    interface{}
+	}{
+		{name: "truncated string", data: []byte{0xa5, 'a'}, v: new(string)},
+		{name: "huge array header", data: []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, v: new([]int)},
+		{name: "extension", data: []byte{0xd4, 1, 0}, v: new(interface{})},
+		{name: "trailing data", data: []byte{0x01, 0x02}, v: new(int)},
+		{name: "overflow", data: []byte{0xcd, 0x01, 0x00}, v: new(int8)},
+		{name: "negative into uint", data: []byte{0xff}, v: new(uint)},
+		{name: "type mismatch", data: []byte{0xa1, 'a'}, v: new(bool)},
+		{name: "nested too deeply", data: bytes.Repeat([]byte{0x91}, maxMsgpackDepth+2), v: new(interface{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (MsgpackCodec{}).Decode(bytes.NewReader(tt.data), tt.v); err == nil {
+				t.Errorf("MsgpackCodec.Decode() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package fastrex
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var shortMimeTypes = map[string]string{
+	"json":       "application/json",
+	"html":       "text/html",
+	"text":       "text/plain",
+	"txt":        "text/plain",
+	"xml":        "application/xml",
+	"js":         "text/javascript",
+	"css":        "text/css",
+	"csv":        "text/csv",
+	"form":       "application/x-www-form-urlencoded",
+	"urlencoded": "application/x-www-form-urlencoded",
+	"multipart":  "multipart/form-data",
+}
+
+type acceptSpec struct {
+	value  string
+	q      float64
+	params int
+}
+
+// normalizeType expands a shorthand such as "json" to its MIME type.
+func normalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if strings.Contains(t, "/") {
+		if i := strings.Index(t, ";"); i >= 0 {
+			t = strings.TrimSpace(t[:i])
+		}
+		return t
+	}
+	if m, ok := shortMimeTypes[t]; ok {
+		return m
+	}
+	if m := mime.TypeByExtension("." + t); m != "" {
+		if i := strings.Index(m, ";"); i >= 0 {
+			m = m[:i]
+		}
+		return m
+	}
+	return t
+}
+
+// parseAccept parses an Accept-style header into specs ordered by preference.
+func parseAccept(header string) []acceptSpec {
+	specs := []acceptSpec{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		spec := acceptSpec{q: 1}
+		fields := strings.Split(part, ";")
+		spec.value = strings.ToLower(strings.TrimSpace(fields[0]))
+		for _, p := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.ToLower(strings.TrimSpace(kv[0])) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || q < 0 {
+					q = 0
+				}
+				if q > 1 {
+					q = 1
+				}
+				spec.q = q
+				continue
+			}
+			spec.params++
+		}
+		specs = append(specs, spec)
+	}
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].q != specs[j].q {
+			return specs[i].q > specs[j].q
+		}
+		return specs[i].params > specs[j].params
+	})
+	return specs
+}
+
+// negotiate returns the offer with the highest quality and the specificity of its match.
+// Ties are broken by the order of the offers.
+func negotiate(header string, offers []string, match func(spec string, offer string) int) string {
+	specs := parseAccept(header)
+	best := ""
+	bestQ := 0.0
+	bestScore := -1
+	for _, offer := range offers {
+		q := -1.0
+		score := -1
+		for _, spec := range specs {
+			s := match(spec.value, offer)
+			if s < 0 {
+				continue
+			}
+			if s > score || (s == score && spec.q > q) {
+				score = s
+				q = spec.q
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && score > bestScore) {
+			best = offer
+			bestQ = q
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func matchMediaType(spec string, offer string) int {
+	offer = normalizeType(offer)
+	if spec == offer {
+		return 2
+	}
+	if spec == "*/*" || spec == "*" {
+		return 0
+	}
+	if strings.HasSuffix(spec, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(spec, "*")) {
+		return 1
+	}
+	return -1
+}
+
+func matchLanguage(spec string, offer string) int {
+	offer = strings.ToLower(offer)
+	switch {
+	case spec == offer:
+		return 2
+	case spec == "*":
+		return 0
+	case strings.HasPrefix(offer, spec+"-"), strings.HasPrefix(spec, offer+"-"):
+		return 1
+	}
+	return -1
+}
+
+func matchToken(spec string, offer string) int {
+	offer = strings.ToLower(offer)
+	if spec == offer {
+		return 1
+	}
+	if spec == "*" {
+		return 0
+	}
+	return -1
+}
+
+func preferred(header string) string {
+	specs := parseAccept(header)
+	for _, s := range specs {
+		if s.q > 0 {
+			return s.value
+		}
+	}
+	return ""
+}
+
+// Accepts returns the best of the given types according to the Accept header, or an empty
+// string when none is acceptable. Types may be MIME types or shorthands such as "json".
+// Without arguments it returns the client's most preferred type.
+func (h *Request) Accepts(types ...string) string {
+	header := h.Header.Get("Accept")
+	if len(types) == 0 {
+		return preferred(header)
+	}
+	if header == "" {
+		return types[0]
+	}
+	return negotiate(header, types, matchMediaType)
+}
+
+// AcceptsLanguages returns the best of the given languages according to the
+// Accept-Language header, or an empty string when none is acceptable.
+func (h *Request) AcceptsLanguages(langs ...string) string {
+	header := h.Header.Get("Accept-Language")
+	if len(langs) == 0 {
+		return preferred(header)
+	}
+	if header == "" {
+		return langs[0]
+	}
+	return negotiate(header, langs, matchLanguage)
+}
+
+// AcceptsEncodings returns the best of the given encodings according to the
+// Accept-Encoding header. The identity encoding is acceptable unless refused explicitly.
+func (h *Request) AcceptsEncodings(encodings ...string) string {
+	header := h.Header.Get("Accept-Encoding")
+	if len(encodings) == 0 {
+		return preferred(header)
+	}
+	if header == "" {
+		return encodings[0]
+	}
+	best := negotiate(header, encodings, matchToken)
+	if best == "" {
+		for _, e := range encodings {
+			if strings.ToLower(e) == "identity" && !refusesIdentity(header) {
+				return e
+			}
+		}
+	}
+	return best
+}
+
+func refusesIdentity(header string) bool {
+	for _, s := range parseAccept(header) {
+		if (s.value == "identity" || s.value == "*") && s.q == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsCharsets returns the best of the given charsets according to the
+// Accept-Charset header, or an empty string when none is acceptable.
+func (h *Request) AcceptsCharsets(charsets ...string) string {
+	header := h.Header.Get("Accept-Charset")
+	if len(charsets) == 0 {
+		return preferred(header)
+	}
+	if header == "" {
+		return charsets[0]
+	}
+	return negotiate(header, charsets, matchToken)
+}
+
+// Is reports whether the request Content-Type matches one of the given types.
+// Types may be MIME types, wildcards such as "text/*" or shorthands such as "json".
+func (h *Request) Is(types ...string) bool {
+	ct := h.Header.Get(HeaderContentType)
+	if ct == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == "*/*" || matchMediaType(normalizeType(t), mediaType) > 0 {
+			return true
+		}
+		if strings.HasPrefix(t, "+") && strings.HasSuffix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *httpResponse) Format(handlers map[string]Handler, order ...string) {
+	offers := []string{}
+	listed := map[string]bool{"default": true}
+	for _, k := range order {
+		if _, ok := handlers[k]; ok && !listed[k] {
+			offers = append(offers, k)
+			listed[k] = true
+		}
+	}
+	rest := []string{}
+	for k := range handlers {
+		if !listed[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	offers = append(offers, rest...)
+
+	h.Append("Vary", "Accept")
+	req := h.request()
+	key := req.Accepts(offers...)
+	handler, ok := handlers[key]
+	if key != "" && ok {
+		h.Type(normalizeType(key))
+	} else if handler, ok = handlers["default"]; !ok {
+		sendStatusError(h.writer(), h.problems(), http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+		return
+	}
+	handler(req, h)
+}
@@ -0,0 +1,187 @@
+package fastrex
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequest_Accepts(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		offers []string
+		accept func(h *Request, offers ...string) string
+		want   string
+	}{
+		{
+			name:   "no header",
+			header: "Accept",
+			offers: []string{"json", "html"},
+			accept: (*Request).Accepts,
+			want:   "json",
+		},
+		{
+			name:   "quality",
+			header: "Accept",
+			value:  "text/html;q=0.5, application/json",
+			offers: []string{"html", "json"},
+			accept: (*Request).Accepts,
+			want:   "json",
+		},
+		{
+			name:   "wildcard",
+			header: "Accept",
+			value:  "text/*, application/json;q=0.1",
+			offers: []string{"application/json", "text/plain"},
+			accept: (*Request).Accepts,
+			want:   "text/plain",
+		},
+		{
+			name:   "not acceptable",
+			header: "Accept",
+			value:  "image/png",
+			offers: []string{"json"},
+			accept: (*Request).Accepts,
+			want:   "",
+		},
+		{
+			name:   "refused with q=0",
+			header: "Accept",
+			value:  "*/*, application/json;q=0",
+			offers: []string{"json", "html"},
+			accept: (*Request).Accepts,
+			want:   "html",
+		},
+		{
+			name:   "preferred",
+			header: "Accept",
+			value:  "text/html;q=0.4, application/xml",
+			accept: (*Request).Accepts,
+			want:   "application/xml",
+		},
+		{
+			name:   "language prefix",
+			header: "Accept-Language",
+			value:  "id, en;q=0.8",
+			offers: []string{"en-US", "fr"},
+			accept: (*Request).AcceptsLanguages,
+			want:   "en-US",
+		},
+		{
+			name:   "encoding identity",
+			header: "Accept-Encoding",
+			value:  "br",
+			offers: []string{"gzip", "identity"},
+			accept: (*Request).AcceptsEncodings,
+			want:   "identity",
+		},
+		{
+			name:   "charset",
+			header: "Accept-Charset",
+			value:  "iso-8859-1;q=0.2, utf-8",
+			offers: []string{"iso-8859-1", "utf-8"},
+			accept: (*Request).AcceptsCharsets,
+			want:   "utf-8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.value != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			h := newRequest(req, nil, false, map[string]interface{}{})
+			if got := tt.accept(h, tt.offers...); got != tt.want {
+				t.Errorf("Request.Accepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequest_Is(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		types       []string
+		want        bool
+	}{
+		{name: "shorthand", contentType: "application/json; charset=utf-8", types: []string{"json"}, want: true},
+		{name: "wildcard", contentType: "text/plain", types: []string{"text/*"}, want: true},
+		{name: "suffix", contentType: "application/vnd.api+json", types: []string{"+json"}, want: true},
+		{name: "mismatch", contentType: "text/html", types: []string{"json", "xml"}, want: false},
+		{name: "empty", contentType: "", types: []string{"json"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			h := newRequest(req, nil, false, map[string]interface{}{})
+			if got := h.Is(tt.types...); got != tt.want {
+				t.Errorf("Request.Is() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_httpResponse_Format(t *testing.T) {
+	handlers := func(withDefault bool) map[string]Handler {
+		m := map[string]Handler{
+			"json": func(req Request, res Response) { res.Send(`{"ok":true}`) },
+			"html": func(req Request, res Response) { res.Send("<p>ok</p>") },
+		}
+		if withDefault {
+			m["default"] = func(req Request, res Response) { res.Send("ok") }
+		}
+		return m
+	}
+	tests := []struct {
+		name        string
+		accept      string
+		order       []string
+		withDefault bool
+		wantStatus  int
+		wantBody    string
+		wantType    string
+	}{
+		{name: "json", accept: "application/json", wantStatus: 200, wantBody: `{"ok":true}`, wantType: "application/json"},
+		{name: "html", accept: "text/html,*/*;q=0.1", wantStatus: 200, wantBody: "<p>ok</p>", wantType: "text/html"},
+		{name: "tie alphabetical", accept: "*/*", wantStatus: 200, wantBody: "<p>ok</p>", wantType: "text/html"},
+		{name: "tie ordered", accept: "*/*", order: []string{"json", "html"}, wantStatus: 200, wantBody: `{"ok":true}`, wantType: "application/json"},
+		{name: "no accept ordered", order: []string{"json"}, wantStatus: 200, wantBody: `{"ok":true}`, wantType: "application/json"},
+		{name: "order keeps client preference", accept: "text/html", order: []string{"json", "html"}, wantStatus: 200, wantBody: "<p>ok</p>", wantType: "text/html"},
+		{name: "default", accept: "image/png", withDefault: true, wantStatus: 200, wantBody: "ok"},
+		{name: "not acceptable", accept: "image/png", wantStatus: 406, wantBody: "Not Acceptable\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				r2.Format(handlers(tt.withDefault), tt.order...)
+			}
+			handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Response.Format() status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if got := string(body); got != tt.wantBody {
+				t.Errorf("Response.Format() = %v, want %v", got, tt.wantBody)
+			}
+			if got := resp.Header.Get("Vary"); got != "Accept" {
+				t.Errorf("Response.Format() Vary = %v, want Accept", got)
+			}
+			if tt.wantType != "" && resp.Header.Get("Content-Type") != tt.wantType {
+				t.Errorf("Response.Format() Content-Type = %v, want %v", resp.Header.Get("Content-Type"), tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package fastrex
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const MimeApplicationProblem = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. It is an error, so handlers can
+// return it through SendError and ErrorMiddleware.
+type Problem struct {
+	// Type is a URI identifying the problem type. Empty means "about:blank", the
+	// plain HTTP status.
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions are sent as additional members. They can not replace the standard ones.
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns a problem for status with the status text as title.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Status: status, Title: http.StatusText(status), Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.title()
+	}
+	return p.title() + ": " + p.Detail
+}
+
+// StatusCode ...
+func (p *Problem) StatusCode() int {
+	if p.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return p.Status
+}
+
+func (p *Problem) title() string {
+	if p.Title == "" && p.Type == "" {
+		return http.StatusText(p.StatusCode())
+	}
+	return p.Title
+}
+
+// MarshalJSON ...
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	members := map[string]interface{}{}
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	if p.Type != "" {
+		members["type"] = p.Type
+	} else {
+		delete(members, "type")
+	}
+	members["title"] = p.title()
+	members["status"] = p.StatusCode()
+	for k, v := range map[string]string{"detail": p.Detail, "instance": p.Instance} {
+		if v != "" {
+			members[k] = v
+		} else {
+			delete(members, k)
+		}
+	}
+	return json.Marshal(members)
+}
+
+// toProblem describes err as a problem with status code. Errors that marshal to a
+// JSON object, such as ValidationErrors, keep their members as extensions, with
+// "message" used as detail. Details of 5xx errors are hidden like SendError does.
+func toProblem(err error, code int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	p = &Problem{Status: code}
+	if code >= http.StatusInternalServerError {
+		return p
+	}
+	p.Detail = err.Error()
+	var m json.Marshaler
+	if !errors.As(err, &m) {
+		return p
+	}
+	var members map[string]interface{}
+	if data, err := m.MarshalJSON(); err != nil || json.Unmarshal(data, &members) != nil {
+		return p
+	}
+	if msg, ok := members["message"].(string); ok {
+		p.Detail = msg
+		delete(members, "message")
+	}
+	if len(members) > 0 {
+		p.Extensions = members
+	}
+	return p
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set(HeaderContentType, MimeApplicationProblem)
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.StatusCode())
+	if _, err := w.Write(body); err != nil {
+		panic(err)
+	}
+}
+
+// sendStatusError answers with code, as problem details when problems is set and
+// as plain text otherwise.
+func sendStatusError(w http.ResponseWriter, problems bool, code int, msg string) {
+	if problems {
+		writeProblem(w, &Problem{Status: code})
+		return
+	}
+	http.Error(w, msg, code)
+}
+
+// Problem sends p as application/problem+json with its status.
+func (h *httpResponse) Problem(p *Problem) {
+	writeProblem(h.writer(), p)
+}
+
+func (h *httpResponse) problems() bool {
+	state := h.request().state
+	return state != nil && state.settings != nil && state.settings.problems
+}
+
+// problemWriter turns error responses written by http.FileServer into problems.
+type problemWriter struct {
+	http.ResponseWriter
+	failed bool
+}
+
+func (w *problemWriter) WriteHeader(code int) {
+	if code < http.StatusBadRequest {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.failed = true
+	w.Header().Del("X-Content-Type-Options")
+	writeProblem(w.ResponseWriter, &Problem{Status: code})
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
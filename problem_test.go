@@ -0,0 +1,242 @@
+package fastrex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblem_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem *Problem
+		want    string
+	}{
+		{
+			name:    "status only",
+			problem: &Problem{Status: 404},
+			want:    `{"status":404,"title":"Not Found"}`,
+		},
+		{
+			name:    "new problem",
+			problem: NewProblem(409, "name is taken"),
+			want:    `{"detail":"name is taken","status":409,"title":"Conflict"}`,
+		},
+		{
+			name: "typed with extensions",
+			problem: &Problem{
+				Type:       "https://example.com/probs/out-of-credit",
+				Title:      "You do not have enough credit.",
+				Status:     403,
+				Instance:   "/account/12345/msgs/abc",
+				Extensions: map[string]interface{}{"balance": 30, "status": 200, "detail": "hidden"},
+			},
+			want: `{"balance":30,"instance":"/account/12345/msgs/abc","status":403,` +
+				`"title":"You do not have enough credit.","type":"https://example.com/probs/out-of-credit"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.problem.MarshalJSON()
+			if err != nil || string(got) != tt.want {
+				t.Errorf("Problem.MarshalJSON() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_httpResponse_Problem(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    HandlerFunc
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "problem",
+			handler: func(r1 Request, r2 Response) {
+				r2.Problem(NewProblem(422, "quantity must be positive"))
+			},
+			wantStatus: 422,
+			wantBody:   `{"detail":"quantity must be positive","status":422,"title":"Unprocessable Entity"}`,
+		},
+		{
+			name: "send error with wrapped problem",
+			handler: func(r1 Request, r2 Response) {
+				r2.SendError(fmt.Errorf("rate limit: %w", NewProblem(429, "slow down")))
+			},
+			wantStatus: 429,
+			wantBody:   `{"detail":"slow down","status":429,"title":"Too Many Requests"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("Response.Problem() = %v %s, want %v %s", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestApp_ProblemDetails(t *testing.T) {
+	gz := &bytes.Buffer{}
+	zw := gzip.NewWriter(gz)
+	zw.Write(bytes.Repeat([]byte("a"), 100))
+	zw.Close()
+
+	app := New().ProblemDetails(true)
+	app.Get("/items/:id", func(req Request, res Response) {
+		res.Send("item")
+	})
+	app.Delete("/items/:id", func(req Request, res Response) {
+		res.Send("deleted")
+	})
+	app.Post("/upload", func(req Request, res Response) {
+		res.Send("uploaded")
+	}, Decompress(DecompressOptions{MaxSize: 10}))
+	app.Get("/admin", func(req Request, res Response) {
+		res.Send("admin")
+	}, func(req Request, res Response, next Next) {
+		next(req.ErrorMiddleware(errors.New("login required"), 401), res)
+	})
+	app.Get("/panic", func(req Request, res Response) {
+		panic("boom")
+	})
+	app.Get("/validate", func(req Request, res Response) {
+		res.SendError(ValidationErrors{{Field: "name", Rule: "required", Message: "name is required"}})
+	})
+	app.Get("/validate/wrapped", func(req Request, res Response) {
+		res.SendError(fmt.Errorf("create: %w", ValidationErrors{{Field: "name", Rule: "required", Message: "name is required"}}))
+	})
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+		wantBody   string
+		wantAllow  string
+	}{
+		{
+			name:       "not found",
+			req:        httptest.NewRequest("GET", "/missing.txt", nil),
+			wantStatus: 404,
+			wantBody:   `{"status":404,"title":"Not Found"}`,
+		},
+		{
+			name:       "method not allowed",
+			req:        httptest.NewRequest("PUT", "/items/1", nil),
+			wantStatus: 405,
+			wantBody:   `{"status":405,"title":"Method Not Allowed"}`,
+			wantAllow:  "DELETE, GET, HEAD",
+		},
+		{
+			name: "body too large",
+			req: func() *http.Request {
+				r := httptest.NewRequest("POST", "/upload", bytes.NewReader(gz.Bytes()))
+				r.Header.Set("Content-Encoding", "gzip")
+				return r
+			}(),
+			wantStatus: 413,
+			wantBody:   `{"detail":"decompress error: body exceeds 10 bytes","status":413,"title":"Request Entity Too Large"}`,
+		},
+		{
+			name:       "middleware error",
+			req:        httptest.NewRequest("GET", "/admin", nil),
+			wantStatus: 401,
+			wantBody:   `{"detail":"login required","status":401,"title":"Unauthorized"}`,
+		},
+		{
+			name:       "panic",
+			req:        httptest.NewRequest("GET", "/panic", nil),
+			wantStatus: 500,
+			wantBody:   `{"status":500,"title":"Internal Server Error"}`,
+		},
+		{
+			name:       "send error",
+			req:        httptest.NewRequest("GET", "/validate", nil),
+			wantStatus: 422,
+			wantBody: `{"detail":"validation failed","errors":[{"field":"name","message":"name is required","rule":"required"}],` +
+				`"status":422,"title":"Unprocessable Entity"}`,
+		},
+		{
+			name:       "wrapped send error",
+			req:        httptest.NewRequest("GET", "/validate/wrapped", nil),
+			wantStatus: 422,
+			wantBody: `{"detail":"validation failed","errors":[{"field":"name","message":"name is required","rule":"required"}],` +
+				`"status":422,"title":"Unprocessable Entity"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, tt.req)
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("App.ServeHTTP() = %v %s, want %v %s", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+			}
+			if got := w.Header().Get(HeaderContentType); got != MimeApplicationProblem {
+				t.Errorf("Content-Type = %v, want %v", got, MimeApplicationProblem)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %v, want %v", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestApp_MethodNotAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		problems   bool
+		method     string
+		wantStatus int
+		wantAllow  string
+		wantBody   string
+	}{
+		{
+			name:       "falls through without problem details",
+			method:     "PUT",
+			wantStatus: 404,
+			wantBody:   "404 page not found\n",
+		},
+		{
+			name:       "405 with problem details",
+			problems:   true,
+			method:     "PUT",
+			wantStatus: 405,
+			wantAllow:  "GET, HEAD, POST",
+			wantBody:   `{"status":405,"title":"Method Not Allowed"}`,
+		},
+		{
+			name:       "HEAD served by the GET route",
+			method:     "HEAD",
+			wantStatus: 200,
+			wantBody:   "items",
+		},
+		{
+			name:       "HEAD served by the GET route with problem details",
+			problems:   true,
+			method:     "HEAD",
+			wantStatus: 200,
+			wantBody:   "items",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New().ProblemDetails(tt.problems)
+			app.Get("/items", func(req Request, res Response) { res.Send("items") })
+			app.Post("/items", func(req Request, res Response) {})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(tt.method, "/items", nil))
+			if w.Code != tt.wantStatus || w.Header().Get("Allow") != tt.wantAllow || w.Body.String() != tt.wantBody {
+				t.Errorf("App.ServeHTTP() = %v %q Allow %q, want %v %q Allow %q",
+					w.Code, w.Body, w.Header().Get("Allow"), tt.wantStatus, tt.wantBody, tt.wantAllow)
+			}
+		})
+	}
+}
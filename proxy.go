@@ -0,0 +1,328 @@
+package fastrex
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+var proxyPresets = map[string][]string{
+	"loopback":    {"127.0.0.1/8", "::1/128"},
+	"linklocal":   {"169.254.0.0/16", "fe80::/10"},
+	"uniquelocal": {"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"},
+}
+
+// trustProxy decides which peers may set X-Forwarded-* and Forwarded headers.
+type trustProxy struct {
+	all  bool
+	hops int
+	nets []*net.IPNet
+}
+
+func parseTrustProxy(value interface{}) (trustProxy, error) {
+	switch v := value.(type) {
+	case bool:
+		return trustProxy{all: v}, nil
+	case int:
+		if v < 0 {
+			return trustProxy{}, fmt.Errorf("trust proxy error: negative hop count %d", v)
+		}
+		return trustProxy{hops: v}, nil
+	case string:
+		return parseTrustProxy(strings.Split(v, ","))
+	case []string:
+		t := trustProxy{}
+		for _, s := range v {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			cidrs, ok := proxyPresets[s]
+			if !ok {
+				cidrs = []string{s}
+			}
+			for _, c := range cidrs {
+				n, err := parseCIDR(c)
+				if err != nil {
+					return trustProxy{}, err
+				}
+				t.nets = append(t.nets, n)
+			}
+		}
+		return t, nil
+	}
+	return trustProxy{}, fmt.Errorf("trust proxy error: unsupported value %T", value)
+}
+
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("trust proxy error: invalid address %q", s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("trust proxy error: %v", err)
+	}
+	return n, nil
+}
+
+// trusted reports whether addr, found hop steps away from the server, is a trusted proxy.
+func (t trustProxy) trusted(addr string, hop int) bool {
+	if t.all {
+		return true
+	}
+	if hop < t.hops {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedElement is one hop of an RFC 7239 Forwarded header.
+type forwardedElement struct {
+	forAddr string
+	proto   string
+	host    string
+}
+
+func parseForwarded(header string) []forwardedElement {
+	elements := []forwardedElement{}
+	for _, part := range splitQuoted(header, ',') {
+		e := forwardedElement{}
+		for _, pair := range splitQuoted(part, ';') {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			switch strings.ToLower(strings.TrimSpace(kv[0])) {
+			case "for":
+				e.forAddr = stripPort(value)
+			case "proto":
+				e.proto = strings.ToLower(value)
+			case "host":
+				e.host = value
+			}
+		}
+		elements = append(elements, e)
+	}
+	return elements
+}
+
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripPort removes the port from an address, handling bracketed IPv6.
+func stripPort(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if strings.HasPrefix(addr, "[") {
+		if i := strings.Index(addr, "]"); i > 0 {
+			return addr[1:i]
+		}
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func splitList(header string) []string {
+	list := []string{}
+	for _, v := range strings.Split(header, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func (h *Request) trust() trustProxy {
+	if h.state == nil || h.state.settings == nil {
+		return trustProxy{}
+	}
+	return h.state.settings.trustProxy
+}
+
+// forwarded returns the hops recorded by proxies, nearest first. Forwarded takes
+// precedence over X-Forwarded-For when both are present.
+func (h *Request) forwarded() []forwardedElement {
+	var elements []forwardedElement
+	if header := h.Header.Get("Forwarded"); header != "" {
+		elements = parseForwarded(strings.Join(h.Header.Values("Forwarded"), ","))
+	} else {
+		for _, addr := range splitList(strings.Join(h.Header.Values("X-Forwarded-For"), ",")) {
+			elements = append(elements, forwardedElement{forAddr: stripPort(addr)})
+		}
+	}
+	for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+		elements[i], elements[j] = elements[j], elements[i]
+	}
+	return elements
+}
+
+// chain returns the socket peer followed by the forwarded hops it vouches for,
+// nearest first, stopping at the first untrusted address.
+func (h *Request) chain() ([]string, []forwardedElement) {
+	trust := h.trust()
+	peer := stripPort(h.RemoteAddr)
+	addrs := []string{peer}
+	hops := []forwardedElement{}
+	if !trust.trusted(peer, 0) {
+		return addrs, hops
+	}
+	for i, e := range h.forwarded() {
+		if e.forAddr == "" {
+			break
+		}
+		addrs = append(addrs, e.forAddr)
+		hops = append(hops, e)
+		if !trust.trusted(e.forAddr, i+1) {
+			break
+		}
+	}
+	return addrs, hops
+}
+
+// IP returns the client address. Forwarding headers are only honored for peers
+// trusted with App.TrustProxy, so spoofed values from untrusted clients are ignored.
+func (h *Request) IP() string {
+	addrs, _ := h.chain()
+	return addrs[len(addrs)-1]
+}
+
+// IPs returns the trusted forwarded addresses from the client to the nearest proxy,
+// or an empty slice when the peer is not a trusted proxy.
+func (h *Request) IPs() []string {
+	addrs, _ := h.chain()
+	ips := []string{}
+	for i := len(addrs) - 1; i > 0; i-- {
+		ips = append(ips, addrs[i])
+	}
+	return ips
+}
+
+func (h *Request) trustedPeer() bool {
+	return h.trust().trusted(stripPort(h.RemoteAddr), 0)
+}
+
+// forwardedValue returns the entry of an X-Forwarded-* list written by the farthest
+// trusted proxy. Entries line up with X-Forwarded-For from the right, so the trusted
+// hop count from chain picks it; without X-Forwarded-For the nearest entry is used.
+func (h *Request) forwardedValue(name string) string {
+	list := splitList(strings.Join(h.Header.Values(name), ","))
+	if len(list) == 0 {
+		return ""
+	}
+	_, hops := h.chain()
+	i := len(list) - 1
+	if len(hops) > 0 {
+		i = len(list) - len(hops)
+	}
+	if i < 0 {
+		i = 0
+	}
+	return list[i]
+}
+
+// Protocol returns "https" or "http". Behind a trusted proxy it honors
+// X-Forwarded-Proto or the proto of the Forwarded header, as set by the farthest
+// trusted proxy.
+func (h *Request) Protocol() string {
+	proto := "http"
+	if h.TLS != nil {
+		proto = "https"
+	}
+	if !h.trustedPeer() {
+		return proto
+	}
+	if header := h.Header.Get("Forwarded"); header != "" {
+		_, hops := h.chain()
+		if len(hops) > 0 && hops[len(hops)-1].proto != "" {
+			return hops[len(hops)-1].proto
+		}
+		return proto
+	}
+	if value := h.forwardedValue("X-Forwarded-Proto"); value != "" {
+		return strings.ToLower(value)
+	}
+	return proto
+}
+
+// Secure reports whether the request was made over TLS.
+func (h *Request) Secure() bool {
+	return h.Protocol() == "https"
+}
+
+// Hostname returns the host name without port. Behind a trusted proxy it honors
+// X-Forwarded-Host or the host of the Forwarded header, as set by the farthest
+// trusted proxy.
+func (h *Request) Hostname() string {
+	host := h.Host
+	if h.trustedPeer() {
+		if header := h.Header.Get("Forwarded"); header != "" {
+			_, hops := h.chain()
+			if len(hops) > 0 && hops[len(hops)-1].host != "" {
+				host = hops[len(hops)-1].host
+			}
+		} else if value := h.forwardedValue("X-Forwarded-Host"); value != "" {
+			host = value
+		}
+	}
+	return stripPort(host)
+}
+
+// Subdomains returns the subdomains of Hostname, nearest to the domain first.
+// The last two labels are treated as the domain; see App.SubdomainOffset.
+func (h *Request) Subdomains() []string {
+	hostname := h.Hostname()
+	subdomains := []string{}
+	if hostname == "" || net.ParseIP(hostname) != nil {
+		return subdomains
+	}
+	offset := 2
+	if h.state != nil && h.state.settings != nil && h.state.settings.subdomainOffset > 0 {
+		offset = h.state.settings.subdomainOffset
+	}
+	labels := strings.Split(hostname, ".")
+	for i := len(labels) - 1 - offset; i >= 0; i-- {
+		subdomains = append(subdomains, labels[i])
+	}
+	return subdomains
+}
+
+// XHR reports whether the request was issued by a client library such as jQuery,
+// which sets X-Requested-With: XMLHttpRequest.
+func (h *Request) XHR() bool {
+	return strings.EqualFold(h.Header.Get("X-Requested-With"), "XMLHttpRequest")
+}
@@ -0,0 +1,226 @@
+package fastrex
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRequest_IP(t *testing.T) {
+	tests := []struct {
+		name    string
+		trust   interface{}
+		remote  string
+		headers map[string]string
+		wantIP  string
+		wantIPs []string
+	}{
+		{
+			name:    "no trust ignores headers",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			wantIP:  "10.0.0.1",
+			wantIPs: []string{},
+		},
+		{
+			name:    "trust all",
+			trust:   true,
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1, 10.0.0.2"},
+			wantIP:  "1.1.1.1",
+			wantIPs: []string{"1.1.1.1", "10.0.0.2"},
+		},
+		{
+			name:    "cidr stops at spoofed entry",
+			trust:   "10.0.0.0/8",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 2.2.2.2, 10.0.0.2"},
+			wantIP:  "2.2.2.2",
+			wantIPs: []string{"2.2.2.2", "10.0.0.2"},
+		},
+		{
+			name:    "untrusted peer",
+			trust:   []string{"loopback"},
+			remote:  "8.8.8.8:1234",
+			headers: map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			wantIP:  "8.8.8.8",
+			wantIPs: []string{},
+		},
+		{
+			name:    "hop count",
+			trust:   1,
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 3.3.3.3"},
+			wantIP:  "3.3.3.3",
+			wantIPs: []string{"3.3.3.3"},
+		},
+		{
+			name:    "forwarded header",
+			trust:   "loopback",
+			remote:  "127.0.0.1:1234",
+			headers: map[string]string{"Forwarded": `for=192.0.2.60;proto=https, for="[2001:db8:cafe::17]:4711"`},
+			wantIP:  "2001:db8:cafe::17",
+			wantIPs: []string{"2001:db8:cafe::17"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New()
+			if tt.trust != nil {
+				app.TrustProxy(tt.trust)
+			}
+			var gotIP string
+			var gotIPs []string
+			app.Get("/", func(req Request, res Response) {
+				gotIP = req.IP()
+				gotIPs = req.IPs()
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			app.ServeHTTP(httptest.NewRecorder(), req)
+			if gotIP != tt.wantIP {
+				t.Errorf("Request.IP() = %v, want %v", gotIP, tt.wantIP)
+			}
+			if !reflect.DeepEqual(gotIPs, tt.wantIPs) {
+				t.Errorf("Request.IPs() = %v, want %v", gotIPs, tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestRequest_Protocol(t *testing.T) {
+	tests := []struct {
+		name           string
+		trust          interface{}
+		tls            bool
+		host           string
+		headers        map[string]string
+		wantProtocol   string
+		wantHostname   string
+		wantSubdomains []string
+	}{
+		{
+			name:           "direct",
+			host:           "api.shop.example.com:8080",
+			wantProtocol:   "http",
+			wantHostname:   "api.shop.example.com",
+			wantSubdomains: []string{"shop", "api"},
+		},
+		{
+			name:           "tls",
+			tls:            true,
+			host:           "example.com",
+			wantProtocol:   "https",
+			wantHostname:   "example.com",
+			wantSubdomains: []string{},
+		},
+		{
+			name:           "spoofed headers ignored",
+			host:           "example.com",
+			headers:        map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"},
+			wantProtocol:   "http",
+			wantHostname:   "example.com",
+			wantSubdomains: []string{},
+		},
+		{
+			name:           "x-forwarded",
+			trust:          true,
+			host:           "internal:8080",
+			headers:        map[string]string{"X-Forwarded-For": "1.1.1.1, 10.0.0.2", "X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "www.example.com"},
+			wantProtocol:   "https",
+			wantHostname:   "www.example.com",
+			wantSubdomains: []string{"www"},
+		},
+		{
+			name:           "x-forwarded nearest proxy",
+			trust:          true,
+			host:           "internal:8080",
+			headers:        map[string]string{"X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "evil.com, www.example.com"},
+			wantProtocol:   "https",
+			wantHostname:   "www.example.com",
+			wantSubdomains: []string{"www"},
+		},
+		{
+			name:           "x-forwarded spoofed entries ignored",
+			trust:          "192.0.2.1",
+			host:           "internal:8080",
+			headers:        map[string]string{"X-Forwarded-For": "6.6.6.6, 1.1.1.1", "X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "evil.com, www.example.com"},
+			wantProtocol:   "https",
+			wantHostname:   "www.example.com",
+			wantSubdomains: []string{"www"},
+		},
+		{
+			name:           "forwarded",
+			trust:          true,
+			host:           "internal",
+			headers:        map[string]string{"Forwarded": `for=1.1.1.1;proto=https;host="app.example.com:443"`},
+			wantProtocol:   "https",
+			wantHostname:   "app.example.com",
+			wantSubdomains: []string{"app"},
+		},
+		{
+			name:           "ip host",
+			host:           "127.0.0.1:3000",
+			wantProtocol:   "http",
+			wantHostname:   "127.0.0.1",
+			wantSubdomains: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := New()
+			if tt.trust != nil {
+				app.TrustProxy(tt.trust)
+			}
+			var protocol, hostname string
+			var secure bool
+			var subdomains []string
+			app.Get("/", func(req Request, res Response) {
+				protocol = req.Protocol()
+				secure = req.Secure()
+				hostname = req.Hostname()
+				subdomains = req.Subdomains()
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Host = tt.host
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			app.ServeHTTP(httptest.NewRecorder(), req)
+			if protocol != tt.wantProtocol || secure != (tt.wantProtocol == "https") {
+				t.Errorf("Request.Protocol() = %v, want %v", protocol, tt.wantProtocol)
+			}
+			if hostname != tt.wantHostname {
+				t.Errorf("Request.Hostname() = %v, want %v", hostname, tt.wantHostname)
+			}
+			if !reflect.DeepEqual(subdomains, tt.wantSubdomains) {
+				t.Errorf("Request.Subdomains() = %v, want %v", subdomains, tt.wantSubdomains)
+			}
+		})
+	}
+}
+
+func TestRequest_XHR(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Requested-With", "xmlhttprequest")
+	h := newRequest(req, nil, false, map[string]interface{}{})
+	if !h.XHR() {
+		t.Errorf("Request.XHR() = false, want true")
+	}
+}
+
+func TestApp_TrustProxy_invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("App.TrustProxy() with an invalid CIDR did not panic")
+		}
+	}()
+	New().TrustProxy("10.0.0.0/99")
+}
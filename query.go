@@ -0,0 +1,223 @@
+package fastrex
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxQueryDepth = 5
+
+// ErrQueryMissing is wrapped by QueryError when the parameter is absent or empty.
+var ErrQueryMissing = errors.New("missing parameter")
+
+// QueryError is returned by the typed query accessors.
+type QueryError struct {
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	if errors.Is(e.Err, ErrQueryMissing) {
+		return "query error: " + strconv.Quote(e.Name) + ": " + e.Err.Error()
+	}
+	return "query error: " + strconv.Quote(e.Name) + " = " + strconv.Quote(e.Value) + ": " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func (h *Request) query() url.Values {
+	if h.URL == nil {
+		return url.Values{}
+	}
+	return h.URL.Query()
+}
+
+// Query returns the first value of the named query-string parameter.
+func (h *Request) Query(name string) string {
+	return h.query().Get(name)
+}
+
+// QueryDefault returns the named query-string parameter, or def when it is absent or empty.
+func (h *Request) QueryDefault(name string, def string) string {
+	if v := h.Query(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// QueryAll returns every value of the named parameter, including values sent
+// with the bracket form, so both ?tags=a&tags=b and ?tags[]=a&tags[]=b work.
+func (h *Request) QueryAll(name string) []string {
+	q := h.query()
+	values := []string{}
+	values = append(values, q[name]...)
+	values = append(values, q[name+"[]"]...)
+	return values
+}
+
+func (h *Request) queryValue(name string) (string, error) {
+	v := h.Query(name)
+	if v == "" {
+		return "", &QueryError{Name: name, Err: ErrQueryMissing}
+	}
+	return v, nil
+}
+
+// QueryInt parses the named parameter as a base 10 integer.
+func (h *Request) QueryInt(name string) (int, error) {
+	v, err := h.queryValue(name)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, &QueryError{Name: name, Value: v, Err: errors.Unwrap(err)}
+	}
+	return i, nil
+}
+
+// QueryBool parses the named parameter as a boolean. Besides the values accepted by
+// strconv.ParseBool it understands on/off and yes/no.
+func (h *Request) QueryBool(name string) (bool, error) {
+	v, err := h.queryValue(name)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(v) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &QueryError{Name: name, Value: v, Err: errors.Unwrap(err)}
+	}
+	return b, nil
+}
+
+// QueryTime parses the named parameter with the given layout, RFC 3339 by default.
+func (h *Request) QueryTime(name string, layout ...string) (time.Time, error) {
+	v, err := h.queryValue(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	l := time.RFC3339
+	if len(layout) > 0 {
+		l = layout[0]
+	}
+	t, err := time.Parse(l, v)
+	if err != nil {
+		return time.Time{}, &QueryError{Name: name, Value: v, Err: err}
+	}
+	return t, nil
+}
+
+// QueryMap parses the query string into nested maps the way Express fills req.query.
+//
+// filter[status]=open becomes {"filter": {"status": "open"}}, tags[]=a&tags[]=b and
+// tags=a&tags=b become {"tags": ["a", "b"]}. Nesting deeper than five levels is kept
+// as a literal key. Keys are applied in the order they first appear in the query
+// string. When a name is used both with and without brackets, as in a=1&a[b]=2, the
+// nested values win and the plain ones are dropped.
+func (h *Request) QueryMap() map[string]interface{} {
+	result := map[string]interface{}{}
+	if h.URL == nil {
+		return result
+	}
+	query := h.query()
+	for _, key := range queryKeys(h.URL.RawQuery) {
+		if values, ok := query[key]; ok {
+			setQueryValue(result, splitQueryKey(key), values)
+		}
+	}
+	return result
+}
+
+// queryKeys returns the distinct keys of a raw query string in order of appearance.
+func queryKeys(raw string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(raw, "&") {
+		key := pair
+		if i := strings.Index(pair, "="); i >= 0 {
+			key = pair[:i]
+		}
+		key, err := url.QueryUnescape(key)
+		if err != nil || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func splitQueryKey(key string) []string {
+	i := strings.Index(key, "[")
+	if i <= 0 {
+		return []string{key}
+	}
+	path := []string{key[:i]}
+	rest := key[i:]
+	for len(rest) > 0 && rest[0] == '[' && len(path) <= maxQueryDepth {
+		j := strings.Index(rest, "]")
+		if j < 0 {
+			break
+		}
+		path = append(path, rest[1:j])
+		rest = rest[j+1:]
+	}
+	if rest != "" {
+		path[len(path)-1] += rest
+	}
+	return path
+}
+
+func setQueryValue(m map[string]interface{}, path []string, values []string) {
+	list := false
+	if len(path) > 1 && path[len(path)-1] == "" {
+		list = true
+		path = path[:len(path)-1]
+	}
+	for _, segment := range path[:len(path)-1] {
+		next, ok := m[segment].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[segment] = next
+		}
+		m = next
+	}
+
+	last := path[len(path)-1]
+	if _, ok := m[last].(map[string]interface{}); ok {
+		return
+	}
+	if !list && len(values) == 1 {
+		if _, ok := m[last]; !ok {
+			m[last] = values[0]
+			return
+		}
+	}
+	m[last] = appendQueryValues(m[last], values)
+}
+
+func appendQueryValues(existing interface{}, values []string) []interface{} {
+	var list []interface{}
+	switch v := existing.(type) {
+	case []interface{}:
+		list = v
+	case string:
+		list = []interface{}{v}
+	}
+	for _, v := range values {
+		list = append(list, v)
+	}
+	return list
+}
@@ -0,0 +1,122 @@
+package fastrex
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRequest_Query(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?page=2&tags=a&tags=b&list[]=x&list[]=y&ok=yes&bad=maybe&at=2021-06-01T10:00:00Z", nil)
+	h := newRequest(req, nil, false, map[string]interface{}{})
+
+	if got := h.Query("page"); got != "2" {
+		t.Errorf("Request.Query() = %v, want %v", got, "2")
+	}
+	if got := h.QueryDefault("size", "10"); got != "10" {
+		t.Errorf("Request.QueryDefault() = %v, want %v", got, "10")
+	}
+	if got := h.QueryAll("tags"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Request.QueryAll() = %v, want %v", got, []string{"a", "b"})
+	}
+	if got := h.QueryAll("list"); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("Request.QueryAll() = %v, want %v", got, []string{"x", "y"})
+	}
+	if got, err := h.QueryInt("page"); got != 2 || err != nil {
+		t.Errorf("Request.QueryInt() = %v, %v, want 2", got, err)
+	}
+	if got, err := h.QueryBool("ok"); !got || err != nil {
+		t.Errorf("Request.QueryBool() = %v, %v, want true", got, err)
+	}
+	want := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	if got, err := h.QueryTime("at"); !got.Equal(want) || err != nil {
+		t.Errorf("Request.QueryTime() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestRequest_Query_errors(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?page=two&bad=maybe", nil)
+	h := newRequest(req, nil, false, map[string]interface{}{})
+
+	_, err := h.QueryInt("size")
+	var qe *QueryError
+	if !errors.As(err, &qe) || !errors.Is(err, ErrQueryMissing) || qe.Name != "size" {
+		t.Errorf("Request.QueryInt() error = %v, want missing size", err)
+	}
+	_, err = h.QueryInt("page")
+	if !errors.As(err, &qe) || !errors.Is(err, strconv.ErrSyntax) || qe.Value != "two" {
+		t.Errorf("Request.QueryInt() error = %v, want syntax error", err)
+	}
+	_, err = h.QueryBool("bad")
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("Request.QueryBool() error = %v, want syntax error", err)
+	}
+	_, err = h.QueryTime("bad")
+	if !errors.As(err, &qe) || qe.Name != "bad" {
+		t.Errorf("Request.QueryTime() error = %v, want parse error", err)
+	}
+}
+
+func TestRequest_QueryMap(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "flat",
+			query: "q=go&tags=a&tags=b",
+			want: map[string]interface{}{
+				"q":    "go",
+				"tags": []interface{}{"a", "b"},
+			},
+		},
+		{
+			name:  "nested",
+			query: "filter[status]=open&filter[owner][name]=agus&ids[]=1&ids[]=2",
+			want: map[string]interface{}{
+				"filter": map[string]interface{}{
+					"status": "open",
+					"owner":  map[string]interface{}{"name": "agus"},
+				},
+				"ids": []interface{}{"1", "2"},
+			},
+		},
+		{
+			name:  "mixed forms",
+			query: "tags=a&tags[]=b&a=1&a[b]=2&c[d]=3&c=4&tags=c",
+			want: map[string]interface{}{
+				"tags": []interface{}{"a", "c", "b"},
+				"a":    map[string]interface{}{"b": "2"},
+				"c":    map[string]interface{}{"d": "3"},
+			},
+		},
+		{
+			name:  "depth limit",
+			query: "a[b][c][d][e][f][g]=1",
+			want: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": map[string]interface{}{
+						"c": map[string]interface{}{
+							"d": map[string]interface{}{
+								"e": map[string]interface{}{"f[g]": "1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?"+tt.query, nil)
+			h := newRequest(req, nil, false, map[string]interface{}{})
+			if got := h.QueryMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Request.QueryMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
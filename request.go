@@ -27,6 +27,7 @@ type Request struct {
 	PostForm         url.Values
 	Routes           map[string]AppRoute
 	container        map[string]interface{}
+	state            *requestState
 	TransferEncoding []string
 	Close            bool
 	Serverless       bool
@@ -74,7 +75,7 @@ func (h *Request) BasicAuth() (username string, password string, ok bool) {
 // lifetime of a request and its response: obtaining a connection,
 // sending the request, and reading the response headers and body.
 func (h *Request) Clone(ctx context.Context) Request {
-	return *newRequest(h.r.Clone(ctx), h.Routes, h.Serverless, h.container)
+	return *newRequest(h.r.Clone(keepState(ctx, h.state)), h.Routes, h.Serverless, h.container)
 }
 
 // FormFile returns the first file for the provided form key.
@@ -183,7 +184,7 @@ func (h *Request) WriteProxy(w io.Writer) error {
 // sending back out, use Request.Clone. Between those two uses,
 // it's rare to need WithContext.
 func (h *Request) WithContext(ctx context.Context) Request {
-	r := h.r.WithContext(ctx)
+	r := h.r.WithContext(keepState(ctx, h.state))
 	return *newRequest(r, h.Routes, h.Serverless, h.container)
 }
 
@@ -205,17 +206,40 @@ func (h *Request) Referer() string {
 	return h.r.Referer()
 }
 
-// GetDependency ...
+// GetDependency returns a value set for this request with SetDependency,
+// falling back to the app dependency added with App.Add.
 func (h *Request) GetDependency(name string) interface{} {
+	if v := h.state.locals.Get(name); v != nil {
+		return v
+	}
 	return h.container[name]
 }
 
-// SetDependency ...
+// SetDependency stores a value for this request only. It is kept for compatibility;
+// use Set instead.
 func (h *Request) SetDependency(name string, content interface{}) *Request {
-	h.container[name] = content
+	return h.Set(name, content)
+}
+
+// Set stores a value that lives until the request ends. Values are shared with
+// Response.Locals and merged into the data passed to Render.
+func (h *Request) Set(key string, value interface{}) *Request {
+	h.state.locals.Set(key, value)
 	return h
 }
 
+// Resolve sets target, a pointer, to the instance of its type from the providers
+// registered with App.Provide. Scoped instances are shared for the rest of the request
+// and disposed when it ends; module providers override the app's on module routes.
+func (h *Request) Resolve(target interface{}) error {
+	return h.state.injector.into(target, &h.state.scope)
+}
+
+// Get returns a value stored with Set, or nil.
+func (h *Request) Get(key string) interface{} {
+	return h.state.locals.Get(key)
+}
+
 // ErrorMiddleware ...
 func (h *Request) ErrorMiddleware(e error, code int) Request {
 	err := ErrMiddleware{
@@ -253,6 +277,7 @@ func newRequest(r *http.Request, routes map[string]AppRoute, serverless bool, co
 		Routes:           routes,
 		Serverless:       serverless,
 		container:        container,
+		state:            stateOf(r),
 	}
 }
 
@@ -1,13 +1,17 @@
 package fastrex
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"math"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const (
@@ -28,62 +32,174 @@ type Response interface {
 	Set(string, string) Response
 	// Sets the HTTP status for the response
 	Status(int) Response
+	// Returns the status sent to the client, or the one set with Status before anything is written.
+	StatusCode() int
+	// Reports whether the header has been written.
+	Written() bool
+	// Returns the number of body bytes written.
+	Size() int64
+	// Sends the header and buffered data to the client. Returns http.ErrNotSupported
+	// when the writer can not flush.
+	Flush() error
+	// Takes over the connection, for protocols such as WebSocket.
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+	// Starts an HTTP/2 server push of target. Returns http.ErrNotSupported without HTTP/2.
+	Push(target string, opts *http.PushOptions) error
+	// Returns the http.ResponseWriter passed to the handler.
+	Unwrap() http.ResponseWriter
+	// Starts a server-sent event stream.
+	SSE(opts ...SSEOptions) (*EventStream, error)
+	// Streams the items of a StreamIterator or channel as newline-delimited JSON.
+	StreamNDJSON(source interface{}, opts ...StreamOptions) error
+	// Streams the items of a StreamIterator or channel as a JSON array.
+	StreamJSONArray(source interface{}, opts ...StreamOptions) error
 	// Sets the Content-Type HTTP header to the MIME type as determined by the specified type.
 	Type(string) Response
 	// Sends a JSON response.
 	Json(data interface{})
+	// Sends data with the registered codec that best matches the Accept header, see
+	// App.Codec. Responds 406 when no codec is acceptable.
+	Encode(data interface{})
 	// Sends the HTTP response.
 	Send(data interface{})
+	// Sends an error as JSON. Errors with a StatusCode() int method, such as
+	// ValidationErrors, set the status; other errors are sent as 500. A *Problem, or
+	// any error when App.ProblemDetails is on, is sent as application/problem+json.
+	SendError(err error)
+	// Sends an RFC 7807 problem details response.
+	Problem(p *Problem)
 	// Sets a created cookie.
 	Cookie(Cookie) Response
-	// Clears the cookie specified by name.
-	ClearCookie(cookie Cookie) Response
+	// Sets a cookie whose value is signed with the app cookie keys, see App.CookieKeys.
+	SignedCookie(Cookie) Response
+	// Sets a cookie whose value is encrypted with the app cookie keys, see App.CookieKeys.
+	EncryptedCookie(Cookie) Response
+	// Clears the cookie with the given name, path and domain. They must match the
+	// values the cookie was set with.
+	ClearCookie(name, path, domain string) Response
 	// Redirects to the URL derived from the specified path, with specified status.
 	Redirect(path string, code int)
 	// Sets the response Location HTTP header to the specified path parameter.
 	Location(path string) Response
 	// Appends the specified value to the HTTP response header field.
 	Append(key string, val string) Response
-	// Renders a view and sends the rendered HTML string to the client.
+	// Returns the values stored for this request. They are merged into the data passed to Render.
+	Locals() *Locals
+	// Renders a view and sends the rendered HTML string to the client. With App.Views,
+	// Render(view, data) uses the default layout and Render(view, data, layout) the
+	// given one; an empty layout renders the view alone.
 	Render(args ...interface{}) error
-	// SendFile()
+	// Calls the handler registered for the best type in the Accept header, or the
+	// "default" handler. Responds with 406 Not Acceptable when nothing matches.
+	// Types the client rates equally, as with no Accept header or */*, go to the
+	// first listed in order, then to the rest in alphabetical order.
+	Format(handlers map[string]Handler, order ...string)
+	// Sends the file at the given path, see FileOptions. Errors can be sent with SendError.
+	SendFile(path string, opts ...FileOptions) error
+	// Sends content from a reader with the same Range and conditional request handling as SendFile.
+	SendReader(name string, modtime time.Time, content io.ReadSeeker)
 	// SendStatus()
-	// Jsonp()
+	// Sends a JSON response wrapped in the callback named by the callback query parameter.
+	Jsonp(data interface{})
 	// Vary() Response
-	// Download()
+	// Sends the file at path as an attachment named filename, the base name of path when empty.
+	Download(path string, filename string, opts ...FileOptions) error
 	// End()
-	// Format() Response
 	// Get() Response
 	// Links() Response
-	// Attachment() Response
+	// Sets Content-Disposition to attachment, with an optional filename that also sets Content-Type.
+	Attachment(filename ...string) Response
 }
 
-func newResponse(w http.ResponseWriter, r *http.Request, t *template.Template, m map[string]*template.Template) Response {
+func newResponse(w http.ResponseWriter, req *Request, t *template.Template, m map[string]*template.Template) Response {
+	state := req.state
+	if state == nil {
+		state = &requestState{}
+	}
 	return &httpResponse{
-		w: w,
-		r: r,
-		s: http.StatusOK,
-		t: t,
-		m: m,
+		jar:   &state.cookies,
+		state: state,
+		w:     w,
+		r:     req.r,
+		req:   req,
+		s:     http.StatusOK,
+		t:     t,
+		m:     m,
 	}
 }
 
 type httpResponse struct {
-	s int
-	c *Cookie
-	w http.ResponseWriter
-	r *http.Request
-	t *template.Template
-	m map[string]*template.Template
+	s     int
+	jar   *cookieJar
+	state *requestState
+	w     http.ResponseWriter
+	r     *http.Request
+	req   *Request
+	t     *template.Template
+	m     map[string]*template.Template
+}
+
+// writer returns the writer shared by every Response of the request, so the header
+// is written once and the cookies queued by any of them are sent with it.
+func (h *httpResponse) writer() *responseWriter {
+	state := h.state
+	if state.writer == nil {
+		state.writer = newResponseWriter(h.w, func() {
+			state.writeCookies(h.w.Header())
+		})
+	}
+	return state.writer
+}
+
+func (h *httpResponse) request() Request {
+	if h.req == nil {
+		return *newRequest(h.r, nil, false, nil)
+	}
+	return *h.req
 }
 
 func (h *httpResponse) Header() http.Header {
-	return h.w.Header()
+	return h.writer().Header()
 }
 
 func (h *httpResponse) Write(data []byte) (int, error) {
-	h.w.WriteHeader(h.s)
-	return h.w.Write(data)
+	if !h.writer().wroteHeader {
+		h.writer().WriteHeader(h.s)
+	}
+	return h.writer().Write(data)
+}
+
+// StatusCode returns the status sent to the client, or the status that will be
+// sent when nothing was written yet.
+func (h *httpResponse) StatusCode() int {
+	if h.writer().wroteHeader {
+		return h.writer().status
+	}
+	return h.s
+}
+
+func (h *httpResponse) Written() bool {
+	return h.writer().wroteHeader
+}
+
+func (h *httpResponse) Size() int64 {
+	return h.writer().size
+}
+
+func (h *httpResponse) Flush() error {
+	return h.writer().flush(h.s)
+}
+
+func (h *httpResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.writer().Hijack()
+}
+
+func (h *httpResponse) Push(target string, opts *http.PushOptions) error {
+	return h.writer().Push(target, opts)
+}
+
+func (h *httpResponse) Unwrap() http.ResponseWriter {
+	return h.w
 }
 
 func (h *httpResponse) WriteHeader(statusCode int) Response {
@@ -92,12 +208,12 @@ func (h *httpResponse) WriteHeader(statusCode int) Response {
 }
 
 func (h *httpResponse) Type(httpType string) Response {
-	h.w.Header().Set(HeaderContentType, httpType)
+	h.writer().Header().Set(HeaderContentType, httpType)
 	return h
 }
 
 func (h *httpResponse) Set(field string, value string) Response {
-	h.w.Header().Set(field, value)
+	h.writer().Header().Set(field, value)
 	return h
 }
 
@@ -107,34 +223,66 @@ func (h *httpResponse) Status(code int) Response {
 }
 
 func (h *httpResponse) Send(data interface{}) {
-	if h.c != nil {
-		c := h.c.cookie()
-		http.SetCookie(h.w, c)
-	}
 	if h.s != http.StatusOK {
-		h.w.WriteHeader(h.s)
+		h.writer().WriteHeader(h.s)
 	}
 	d := []byte(fmt.Sprintf("%v", data))
-	_, err := h.w.Write(d)
+	_, err := h.writer().Write(d)
 	if err != nil {
 		panic(err)
 	}
 }
 
 func (h *httpResponse) Json(data interface{}) {
-	var jsonStr string
-	switch data.(type) {
-	case string, bool, int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, complex64, complex128:
-		jsonStr = fmt.Sprintf("%v", data)
-	default:
-		jsonStr = processStruct(data)
+	body, err := h.jsonOptions().marshal(data)
+	if err != nil {
+		h.SendError(err)
+		return
 	}
-	h.w.Header().Set(HeaderContentType, MimeApplicationJson)
-	if h.c != nil {
-		c := h.c.cookie()
-		http.SetCookie(h.w, c)
+	h.writer().Header().Set(HeaderContentType, MimeApplicationJson)
+	if h.s != http.StatusOK {
+		h.writer().WriteHeader(h.s)
 	}
-	_, err := h.w.Write([]byte(jsonStr))
+	_, err = h.writer().Write(body)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (h *httpResponse) jsonOptions() JSONEncodeOptions {
+	state := h.request().state
+	if state == nil || state.settings == nil {
+		return JSONEncodeOptions{}
+	}
+	return state.settings.json
+}
+
+func (h *httpResponse) SendError(err error) {
+	code := http.StatusInternalServerError
+	var coder interface{ StatusCode() int }
+	if errors.As(err, &coder) {
+		code = coder.StatusCode()
+	}
+	var problem *Problem
+	if errors.As(err, &problem) || h.problems() {
+		h.Problem(toProblem(err, code))
+		return
+	}
+
+	var body interface{}
+	var m json.Marshaler
+	if errors.As(err, &m) {
+		body = m
+	} else if code >= http.StatusInternalServerError {
+		body = map[string]string{"message": http.StatusText(code)}
+	} else {
+		body = map[string]string{"message": err.Error()}
+	}
+
+	jsonStr := processStruct(body)
+	h.writer().Header().Set(HeaderContentType, MimeApplicationJson)
+	h.writer().WriteHeader(code)
+	_, err = h.writer().Write([]byte(jsonStr))
 	if err != nil {
 		panic(err)
 	}
@@ -149,39 +297,40 @@ func processStruct(data interface{}) string {
 }
 
 func (h *httpResponse) Cookie(cookie Cookie) Response {
-	h.c = &cookie
+	h.jar.add(cookie)
 	return h
 }
 
-func (h *httpResponse) ClearCookie(cookie Cookie) Response {
-	c := Cookie{}
-	if cookie.c.Name != "" {
-		c.c = cookie.c
-		c.MaxAge(-1)
-		h.c = &c
+func (h *httpResponse) ClearCookie(name, path, domain string) Response {
+	if name == "" {
+		return h
+	}
+	c := Cookie{c: http.Cookie{
+		Name:    name,
+		Path:    path,
+		Domain:  domain,
+		Expires: time.Unix(0, 0),
+		MaxAge:  -1,
+	}}
+	// Browsers ignore prefixed cookies without Secure, including the ones that clear them.
+	if lower := strings.ToLower(name); strings.HasPrefix(lower, "__secure-") || strings.HasPrefix(lower, "__host-") {
+		c.Secure(true)
 	}
+	h.jar.add(c)
 	return h
 }
 
 func (h *httpResponse) Redirect(url string, code int) {
-	if h.c != nil {
-		c := h.c.cookie()
-		http.SetCookie(h.w, c)
-	}
-	http.Redirect(h.w, h.r, url, code)
+	http.Redirect(h.writer(), h.r, url, code)
 }
 
 func (h *httpResponse) Location(path string) Response {
-	if h.c != nil {
-		c := h.c.cookie()
-		http.SetCookie(h.w, c)
-	}
-	h.w.Header().Set("Location", path)
+	h.writer().Header().Set("Location", path)
 	return h
 }
 
 func (h *httpResponse) Append(field string, value string) Response {
-	h.w.Header().Add(field, value)
+	h.writer().Header().Add(field, value)
 	return h
 }
 
@@ -199,7 +348,35 @@ func (h *httpResponse) getModuleTemplateKey(url string, list map[string]*templat
 	return rslt
 }
 
+func (h *httpResponse) Locals() *Locals {
+	return &h.request().state.locals
+}
+
+// withLocals merges request locals into template data. Values in data win;
+// data that is not a map is returned unchanged.
+func (h *httpResponse) withLocals(data interface{}) interface{} {
+	locals := h.Locals().All()
+	if len(locals) == 0 {
+		return data
+	}
+	switch d := data.(type) {
+	case nil:
+		return locals
+	case map[string]interface{}:
+		for k, v := range d {
+			locals[k] = v
+		}
+		return locals
+	}
+	return data
+}
+
 func (h *httpResponse) Render(args ...interface{}) error {
+	if name, layout, ok, err := viewArgs(h.views(), args); err != nil {
+		return err
+	} else if ok {
+		return h.renderView(h.views(), name, layout, args[1])
+	}
 	if h.t == nil {
 		templateKey := ""
 		if len(h.m) > 0 {
@@ -217,57 +394,36 @@ func (h *httpResponse) Render(args ...interface{}) error {
 		}
 		h.t = tmpl
 	}
-	if h.c != nil {
-		c := h.c.cookie()
-		http.SetCookie(h.w, c)
-	}
 	length := len(args)
-	h.w.Header().Set(HeaderContentType, MimeTextHtml)
+	h.writer().Header().Set(HeaderContentType, MimeTextHtml)
 	if length == 0 || length == 1 {
 		if length == 0 {
-			return template.Must(h.t.Clone()).Execute(h.w, nil)
+			return template.Must(h.t.Clone()).Execute(h.writer(), h.withLocals(nil))
 		}
-		return template.Must(h.t.Clone()).Execute(h.w, args[0])
+		return template.Must(h.t.Clone()).Execute(h.writer(), h.withLocals(args[0]))
 	} else if length == 2 {
 		name := args[0].(string)
-		data := args[1]
+		data := h.withLocals(args[1])
 		if name == "" {
 			return errors.New("Render error: empty template name")
 		}
-		return template.Must(h.t.Clone()).ExecuteTemplate(h.w, name, data)
+		return template.Must(h.t.Clone()).ExecuteTemplate(h.writer(), name, data)
 	}
 	return errors.New("Render error: invalid args")
 }
 
 // TODO:
-// func (h *httpResponse) Attachment() Response {
-// 	return h
-// }
-
-// func (h *httpResponse) Download() {
-// }
-
 // func (h *httpResponse) End() {
 // }
 
-// func (h *httpResponse) Format() Response {
-// 	return h
-// }
-
 // func (h *httpResponse) Get() Response {
 // 	return h
 // }
 
-// func (h *httpResponse) Jsonp() {
-// }
-
 // func (h *httpResponse) Links() Response {
 // 	return h
 // }
 
-// func (h *httpResponse) SendFile() {
-// }
-
 // func (h *httpResponse) SendStatus() {
 // }
 
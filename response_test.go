@@ -21,7 +21,7 @@ func Test_httpResponse_Send(t *testing.T) {
 			handler: func(r1 Request, r2 Response) {
 				r2.Json("ping")
 			},
-			wantBody:   "ping",
+			wantBody:   `"ping"`,
 			wantStatus: 200,
 			wantHeader: map[string][]string{
 				"Content-Type": {"application/json"},
@@ -52,8 +52,19 @@ func Test_httpResponse_Send(t *testing.T) {
 				value := make(chan int)
 				r2.Json(value)
 			},
-			wantBody:   `json: unsupported type: chan int`,
-			wantStatus: 200,
+			wantBody:   `{"message":"Internal Server Error"}`,
+			wantStatus: 500,
+			wantHeader: map[string][]string{
+				"Content-Type": {"application/json"},
+			},
+		},
+		{
+			name: "json with status",
+			handler: func(r1 Request, r2 Response) {
+				r2.Status(201).Json(map[string]string{"html": "<b>"})
+			},
+			wantBody:   `{"html":"\u003cb\u003e"}`,
+			wantStatus: 201,
 			wantHeader: map[string][]string{
 				"Content-Type": {"application/json"},
 			},
@@ -143,15 +154,31 @@ func Test_httpResponse_Send(t *testing.T) {
 		{
 			name: "send with clear cookie",
 			handler: func(r1 Request, r2 Response) {
-				c := Cookie{}
-				c.Name("name").Value("agus")
-				r2.ClearCookie(c).Send("ping")
+				r2.ClearCookie("name", "/", "")
+				r2.Send("ping")
 			},
 			wantBody:   "ping",
 			wantStatus: 200,
 			wantHeader: map[string][]string{
 				"Content-Type": {"text/plain; charset=utf-8"},
-				"Set-Cookie":   {"name=agus; Max-Age=0"},
+				"Set-Cookie":   {"name=; Path=/; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0"},
+			},
+		},
+		{
+			name: "send with multiple cookies",
+			handler: func(r1 Request, r2 Response) {
+				a := Cookie{}
+				a.Name("a").Value("1")
+				b := Cookie{}
+				b.Name("b").Value("2")
+				r2.Cookie(a).Cookie(b).ClearCookie("old", "", "")
+				r2.Send("ping")
+			},
+			wantBody:   "ping",
+			wantStatus: 200,
+			wantHeader: map[string][]string{
+				"Content-Type": {"text/plain; charset=utf-8"},
+				"Set-Cookie":   {"a=1", "b=2", "old=; Expires=Thu, 01 Jan 1970 00:00:00 GMT; Max-Age=0"},
 			},
 		},
 	}
@@ -476,3 +503,24 @@ func Test_httpResponse_Render(t *testing.T) {
 		})
 	}
 }
+
+func Test_httpResponse_Cookie_middleware(t *testing.T) {
+	app := New()
+	app.Use(func(req Request, res Response, next Next) {
+		c := Cookie{}
+		c.Name("session").Value("abc").Path("/")
+		res.Cookie(c)
+		next(req, res)
+	})
+	app.Get("/", func(req Request, res Response) {
+		c := Cookie{}
+		c.Name("theme").Value("dark")
+		res.Cookie(c).Json("ok")
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := []string{"session=abc; Path=/", "theme=dark"}
+	if got := w.Result().Header["Set-Cookie"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Response.Cookie() = %v, want %v", got, want)
+	}
+}
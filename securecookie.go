@@ -0,0 +1,204 @@
+package fastrex
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+const minCookieKeyLen = 16
+
+var (
+	// ErrCookieInvalid is returned for signed or encrypted cookies that fail verification.
+	ErrCookieInvalid = errors.New("invalid cookie")
+	// ErrCookieExpired is returned for signed or encrypted cookies past their embedded expiry.
+	ErrCookieExpired = errors.New("cookie expired")
+	// ErrNoCookieKeys is returned when signed or encrypted cookies are used before App.CookieKeys.
+	ErrNoCookieKeys = errors.New("no cookie keys configured")
+)
+
+// cookieKey holds the keys derived from one configured secret.
+type cookieKey struct {
+	sign []byte
+	aead cipher.AEAD
+}
+
+func newCookieKey(secret []byte) (cookieKey, error) {
+	if len(secret) < minCookieKeyLen {
+		return cookieKey{}, errors.New("cookie error: keys must be at least 16 bytes")
+	}
+	block, err := aes.NewCipher(deriveKey(secret, "fastrex cookie encryption"))
+	if err != nil {
+		return cookieKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return cookieKey{}, err
+	}
+	return cookieKey{sign: deriveKey(secret, "fastrex cookie signature"), aead: aead}, nil
+}
+
+// deriveKey separates the signing and encryption keys so one secret can serve both.
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SignedCookie sets a cookie whose value is signed with the first cookie key. The
+// value stays readable by the client but can not be changed.
+func (h *httpResponse) SignedCookie(cookie Cookie) Response {
+	keys := h.cookieKeys()
+	if len(keys) == 0 {
+		panic("cookie error: " + ErrNoCookieKeys.Error())
+	}
+	payload := cookiePayload(cookie)
+	mac := signCookie(keys[0], cookie.c.Name, payload)
+	cookie.c.Value = encodeCookie(payload) + "." + encodeCookie(mac)
+	return h.Cookie(cookie)
+}
+
+// EncryptedCookie sets a cookie whose value is encrypted and authenticated with the
+// first cookie key.
+func (h *httpResponse) EncryptedCookie(cookie Cookie) Response {
+	keys := h.cookieKeys()
+	if len(keys) == 0 {
+		panic("cookie error: " + ErrNoCookieKeys.Error())
+	}
+	aead := keys[0].aead
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	sealed := aead.Seal(nonce, nonce, cookiePayload(cookie), []byte(cookie.c.Name))
+	cookie.c.Value = encodeCookie(sealed)
+	return h.Cookie(cookie)
+}
+
+func (h *httpResponse) cookieKeys() []cookieKey {
+	state := h.request().state
+	if state == nil || state.settings == nil {
+		return nil
+	}
+	return state.settings.cookieKeys
+}
+
+// SignedCookie returns the named cookie set with Response.SignedCookie, with its
+// original value. Every configured key is tried, so cookies signed before a key
+// rotation keep working.
+func (h *Request) SignedCookie(name string) (Cookie, error) {
+	c, err := h.Cookie(name)
+	if err != nil {
+		return c, err
+	}
+	keys := h.cookieKeys()
+	if len(keys) == 0 {
+		return Cookie{}, ErrNoCookieKeys
+	}
+	i := strings.LastIndexByte(c.c.Value, '.')
+	if i < 0 {
+		return Cookie{}, ErrCookieInvalid
+	}
+	payload, err1 := decodeCookie(c.c.Value[:i])
+	mac, err2 := decodeCookie(c.c.Value[i+1:])
+	if err1 != nil || err2 != nil {
+		return Cookie{}, ErrCookieInvalid
+	}
+	for _, key := range keys {
+		if hmac.Equal(mac, signCookie(key, name, payload)) {
+			return openPayload(c, payload)
+		}
+	}
+	return Cookie{}, ErrCookieInvalid
+}
+
+// EncryptedCookie returns the named cookie set with Response.EncryptedCookie, with
+// its decrypted value.
+func (h *Request) EncryptedCookie(name string) (Cookie, error) {
+	c, err := h.Cookie(name)
+	if err != nil {
+		return c, err
+	}
+	keys := h.cookieKeys()
+	if len(keys) == 0 {
+		return Cookie{}, ErrNoCookieKeys
+	}
+	sealed, err := decodeCookie(c.c.Value)
+	if err != nil {
+		return Cookie{}, ErrCookieInvalid
+	}
+	for _, key := range keys {
+		size := key.aead.NonceSize()
+		if len(sealed) < size {
+			return Cookie{}, ErrCookieInvalid
+		}
+		payload, err := key.aead.Open(nil, sealed[:size], sealed[size:], []byte(name))
+		if err == nil {
+			return openPayload(c, payload)
+		}
+	}
+	return Cookie{}, ErrCookieInvalid
+}
+
+func (h *Request) cookieKeys() []cookieKey {
+	if h.state == nil || h.state.settings == nil {
+		return nil
+	}
+	return h.state.settings.cookieKeys
+}
+
+// cookiePayload is the expiry as Unix seconds, zero for session cookies, followed
+// by the value. The expiry is taken from MaxAge, or Expires when MaxAge is not set.
+func cookiePayload(cookie Cookie) []byte {
+	var expires int64
+	switch {
+	case cookie.c.MaxAge > 0:
+		expires = time.Now().Add(time.Duration(cookie.c.MaxAge) * time.Second).Unix()
+	case cookie.c.MaxAge == 0 && !cookie.c.Expires.IsZero():
+		expires = cookie.c.Expires.Unix()
+	}
+	payload := make([]byte, 8, 8+len(cookie.c.Value))
+	binary.BigEndian.PutUint64(payload, uint64(expires))
+	return append(payload, cookie.c.Value...)
+}
+
+func openPayload(c Cookie, payload []byte) (Cookie, error) {
+	if len(payload) < 8 {
+		return Cookie{}, ErrCookieInvalid
+	}
+	expires := int64(binary.BigEndian.Uint64(payload))
+	if expires != 0 {
+		if time.Now().Unix() >= expires {
+			return Cookie{}, ErrCookieExpired
+		}
+		c.c.Expires = time.Unix(expires, 0)
+	}
+	c.c.Value = string(payload[8:])
+	return c, nil
+}
+
+// signCookie binds the cookie name into the MAC so a value can not be moved to
+// another cookie.
+func signCookie(key cookieKey, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key.sign)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func encodeCookie(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCookie(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
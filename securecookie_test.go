@@ -0,0 +1,158 @@
+package fastrex
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testOldKey = []byte("old-secret-key-0123456789")
+	testNewKey = []byte("new-secret-key-0123456789")
+)
+
+// issueCookie returns the Set-Cookie value produced by set with the given keys.
+func issueCookie(t *testing.T, keys [][]byte, set func(Response)) *http.Cookie {
+	app := New().CookieKeys(keys...)
+	app.Get("/", func(req Request, res Response) {
+		set(res)
+		res.Send("ok")
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("issueCookie() cookies = %v", cookies)
+	}
+	return cookies[0]
+}
+
+// readCookie sends c with the given keys and returns what read reported.
+func readCookie(keys [][]byte, c *http.Cookie, read func(Request) (Cookie, error)) (Cookie, error) {
+	app := New()
+	if len(keys) > 0 {
+		app.CookieKeys(keys...)
+	}
+	var got Cookie
+	var err error
+	app.Get("/", func(req Request, res Response) {
+		got, err = read(req)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(c)
+	app.ServeHTTP(httptest.NewRecorder(), req)
+	return got, err
+}
+
+func TestRequest_SignedCookie(t *testing.T) {
+	read := func(req Request) (Cookie, error) { return req.SignedCookie("user") }
+	signed := issueCookie(t, [][]byte{testOldKey}, func(res Response) {
+		c := Cookie{}
+		c.Name("user").Value("agus").MaxAge(60)
+		res.SignedCookie(c)
+	})
+	if !strings.Contains(signed.Value, ".") {
+		t.Fatalf("Response.SignedCookie() value = %v", signed.Value)
+	}
+
+	tampered := *signed
+	tampered.Value = encodeCookie(append(make([]byte, 8), "root"...)) + signed.Value[strings.LastIndexByte(signed.Value, '.'):]
+	moved := *signed
+	moved.Name = "admin"
+	expired := issueCookie(t, [][]byte{testOldKey}, func(res Response) {
+		c := Cookie{}
+		c.Name("user").Value("agus").Expires(time.Now().Add(-time.Hour))
+		res.SignedCookie(c)
+	})
+
+	tests := []struct {
+		name    string
+		keys    [][]byte
+		cookie  *http.Cookie
+		read    func(Request) (Cookie, error)
+		want    string
+		wantErr error
+	}{
+		{name: "valid", keys: [][]byte{testOldKey}, cookie: signed, read: read, want: "agus"},
+		{name: "rotated key", keys: [][]byte{testNewKey, testOldKey}, cookie: signed, read: read, want: "agus"},
+		{name: "retired key", keys: [][]byte{testNewKey}, cookie: signed, read: read, wantErr: ErrCookieInvalid},
+		{name: "tampered", keys: [][]byte{testOldKey}, cookie: &tampered, read: read, wantErr: ErrCookieInvalid},
+		{
+			name:    "moved to another name",
+			keys:    [][]byte{testOldKey},
+			cookie:  &moved,
+			read:    func(req Request) (Cookie, error) { return req.SignedCookie("admin") },
+			wantErr: ErrCookieInvalid,
+		},
+		{name: "expired", keys: [][]byte{testOldKey}, cookie: expired, read: read, wantErr: ErrCookieExpired},
+		{name: "no keys", cookie: signed, read: read, wantErr: ErrNoCookieKeys},
+		{
+			name:    "missing",
+			keys:    [][]byte{testOldKey},
+			cookie:  signed,
+			read:    func(req Request) (Cookie, error) { return req.SignedCookie("other") },
+			wantErr: http.ErrNoCookie,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCookie(tt.keys, tt.cookie, tt.read)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Request.SignedCookie() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.GetValue() != tt.want {
+				t.Errorf("Request.SignedCookie() = %v, want %v", got.GetValue(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRequest_EncryptedCookie(t *testing.T) {
+	read := func(req Request) (Cookie, error) { return req.EncryptedCookie("prefs") }
+	encrypted := issueCookie(t, [][]byte{testOldKey}, func(res Response) {
+		c := Cookie{}
+		c.Name("prefs").Value("theme=dark")
+		res.EncryptedCookie(c)
+	})
+	if strings.Contains(encrypted.Value, "dark") {
+		t.Fatalf("Response.EncryptedCookie() leaks value: %v", encrypted.Value)
+	}
+	tampered := *encrypted
+	tampered.Value = encrypted.Value[:len(encrypted.Value)-2] + "AA"
+
+	tests := []struct {
+		name    string
+		keys    [][]byte
+		cookie  *http.Cookie
+		want    string
+		wantErr error
+	}{
+		{name: "valid", keys: [][]byte{testOldKey}, cookie: encrypted, want: "theme=dark"},
+		{name: "rotated key", keys: [][]byte{testNewKey, testOldKey}, cookie: encrypted, want: "theme=dark"},
+		{name: "wrong key", keys: [][]byte{testNewKey}, cookie: encrypted, wantErr: ErrCookieInvalid},
+		{name: "tampered", keys: [][]byte{testOldKey}, cookie: &tampered, wantErr: ErrCookieInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCookie(tt.keys, tt.cookie, read)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Request.EncryptedCookie() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.GetValue() != tt.want {
+				t.Errorf("Request.EncryptedCookie() = %v, want %v", got.GetValue(), tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_CookieKeys_short(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("App.CookieKeys() with a short key did not panic")
+		}
+	}()
+	New().CookieKeys([]byte("short"))
+}
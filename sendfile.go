@@ -0,0 +1,260 @@
+package fastrex
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Dotfiles controls how SendFile treats files and directories whose name starts with a dot.
+type Dotfiles int
+
+const (
+	// DotfilesIgnore responds as if dotfiles did not exist.
+	DotfilesIgnore Dotfiles = iota
+	// DotfilesDeny rejects dotfiles with 403.
+	DotfilesDeny
+	// DotfilesAllow serves dotfiles like any other file.
+	DotfilesAllow
+)
+
+// ErrForbiddenPath is reported for paths that escape the root or are denied dotfiles.
+var ErrForbiddenPath = errors.New("forbidden path")
+
+// FileOptions configures SendFile.
+type FileOptions struct {
+	// Root is the directory relative paths are resolved against. Paths can not leave it.
+	// Without Root the path must be absolute.
+	Root     string
+	Dotfiles Dotfiles
+	// MaxAge sets Cache-Control max-age. Zero sends "public, max-age=0".
+	MaxAge time.Duration
+	// Immutable adds the immutable directive to Cache-Control.
+	Immutable bool
+}
+
+// FileError describes why SendFile could not send a file. SendError renders it
+// with 404, 403 or 500.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return "sendfile error: " + strconv.Quote(e.Path) + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode ...
+func (e *FileError) StatusCode() int {
+	switch {
+	case errors.Is(e.Err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(e.Err, ErrForbiddenPath), errors.Is(e.Err, os.ErrPermission):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// SendFile sends the file at name, honoring Range, If-Range and conditional
+// headers. Nothing is written when an error is returned, so the caller can
+// respond with SendError.
+func (h *httpResponse) SendFile(name string, opts ...FileOptions) error {
+	opt := FileOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	file, err := resolveFile(name, opt)
+	if err != nil {
+		return &FileError{Path: name, Err: err}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return &FileError{Path: name, Err: err}
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return &FileError{Path: name, Err: err}
+	}
+	if info.IsDir() {
+		return &FileError{Path: name, Err: os.ErrNotExist}
+	}
+
+	header := h.writer().Header()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", fileETag(info.Size(), info.ModTime()))
+	}
+	if header.Get("Cache-Control") == "" {
+		cache := "public, max-age=" + strconv.FormatInt(int64(opt.MaxAge/time.Second), 10)
+		if opt.Immutable {
+			cache += ", immutable"
+		}
+		header.Set("Cache-Control", cache)
+	}
+	h.serveContent(info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// SendReader sends content the same way as SendFile. name sets the Content-Type and
+// modtime the Last-Modified header; a zero modtime omits it.
+func (h *httpResponse) SendReader(name string, modtime time.Time, content io.ReadSeeker) {
+	h.serveContent(name, modtime, content)
+}
+
+func (h *httpResponse) serveContent(name string, modtime time.Time, content io.ReadSeeker) {
+	http.ServeContent(h.writer(), h.r, name, modtime, content)
+}
+
+// Attachment sets Content-Disposition to attachment. With a filename, the name is
+// added and Content-Type is inferred from its extension.
+func (h *httpResponse) Attachment(filename ...string) Response {
+	name := ""
+	if len(filename) > 0 {
+		name = filename[0]
+	}
+	h.writer().Header().Set("Content-Disposition", contentDisposition(name))
+	if name != "" {
+		if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+			h.writer().Header().Set(HeaderContentType, t)
+		}
+	}
+	return h
+}
+
+// Download sends the file at name as an attachment. filename defaults to the base
+// name of the file.
+func (h *httpResponse) Download(name string, filename string, opts ...FileOptions) error {
+	if filename == "" {
+		filename = filepath.Base(name)
+	}
+	header := h.writer().Header()
+	disposition, contentType := header.Get("Content-Disposition"), header.Get(HeaderContentType)
+	h.Attachment(filename)
+	err := h.SendFile(name, opts...)
+	if err != nil {
+		// Leave the headers as they were so the error can be sent normally.
+		setOrDelete(header, "Content-Disposition", disposition)
+		setOrDelete(header, HeaderContentType, contentType)
+	}
+	return err
+}
+
+func setOrDelete(header http.Header, key, value string) {
+	if value == "" {
+		header.Del(key)
+		return
+	}
+	header.Set(key, value)
+}
+
+// contentDisposition builds an RFC 6266 attachment header. Names that are not plain
+// ASCII get an ASCII fallback plus the UTF-8 filename* parameter from RFC 5987.
+func contentDisposition(filename string) string {
+	if filename == "" {
+		return "attachment"
+	}
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= utf8.RuneSelf || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, filename)
+	value := "attachment; filename=" + strconv.Quote(fallback)
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent encodes everything except attr-char.
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// resolveFile maps name to a file on disk according to opt.
+func resolveFile(name string, opt FileOptions) (string, error) {
+	if strings.IndexByte(name, 0) >= 0 {
+		return "", ErrForbiddenPath
+	}
+	rel := name
+	if opt.Root == "" {
+		if !filepath.IsAbs(name) {
+			return "", errors.New("path must be absolute or FileOptions.Root must be set")
+		}
+	} else {
+		for _, seg := range strings.FieldsFunc(filepath.ToSlash(name), isSlash) {
+			if seg == ".." {
+				return "", ErrForbiddenPath
+			}
+		}
+		rel = path.Clean("/" + filepath.ToSlash(name))
+	}
+
+	if opt.Dotfiles != DotfilesAllow {
+		for _, seg := range strings.FieldsFunc(filepath.ToSlash(rel), isSlash) {
+			if len(seg) > 1 && seg[0] == '.' && seg != ".." {
+				if opt.Dotfiles == DotfilesDeny {
+					return "", ErrForbiddenPath
+				}
+				return "", os.ErrNotExist
+			}
+		}
+	}
+
+	if opt.Root == "" {
+		return filepath.Clean(name), nil
+	}
+	root, err := filepath.Abs(opt.Root)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(root, filepath.FromSlash(rel))
+	// Symlinks inside root may still point outside of it.
+	real, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator)) {
+		return "", ErrForbiddenPath
+	}
+	return real, nil
+}
+
+func isSlash(r rune) bool {
+	return r == '/'
+}
+
+// fileETag builds a validator from the size and modification time. It is strong so
+// that If-Range can use it.
+func fileETag(size int64, modtime time.Time) string {
+	return fmt.Sprintf(`"%x-%x"`, size, modtime.UnixNano())
+}
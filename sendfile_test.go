@@ -0,0 +1,205 @@
+package fastrex
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponse_SendFile(t *testing.T) {
+	root := t.TempDir()
+	ioutil.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello world"), 0644)
+	ioutil.WriteFile(filepath.Join(root, ".env"), []byte("SECRET=1"), 0644)
+	os.Mkdir(filepath.Join(root, "dir"), 0755)
+	outside := t.TempDir()
+	ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt"))
+
+	tests := []struct {
+		name       string
+		path       string
+		opts       FileOptions
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+		wantErr    int
+	}{
+		{name: "file", path: "hello.txt", opts: FileOptions{Root: root}, wantStatus: 200, wantBody: "hello world"},
+		{name: "absolute", path: filepath.Join(root, "hello.txt"), wantStatus: 200, wantBody: "hello world"},
+		{name: "relative without root", path: "hello.txt", wantErr: 500},
+		{name: "missing", path: "nope.txt", opts: FileOptions{Root: root}, wantErr: 404},
+		{name: "directory", path: "dir", opts: FileOptions{Root: root}, wantErr: 404},
+		{name: "traversal", path: "../" + filepath.Base(outside) + "/secret.txt", opts: FileOptions{Root: root}, wantErr: 403},
+		{name: "symlink outside root", path: "link.txt", opts: FileOptions{Root: root}, wantErr: 403},
+		{name: "dotfile ignored", path: ".env", opts: FileOptions{Root: root}, wantErr: 404},
+		{name: "dotfile denied", path: ".env", opts: FileOptions{Root: root, Dotfiles: DotfilesDeny}, wantErr: 403},
+		{name: "dotfile allowed", path: ".env", opts: FileOptions{Root: root, Dotfiles: DotfilesAllow}, wantStatus: 200, wantBody: "SECRET=1"},
+		{
+			name:       "range",
+			path:       "hello.txt",
+			opts:       FileOptions{Root: root},
+			headers:    map[string]string{"Range": "bytes=0-4"},
+			wantStatus: 206,
+			wantBody:   "hello",
+		},
+		{
+			name:       "if-range mismatch",
+			path:       "hello.txt",
+			opts:       FileOptions{Root: root},
+			headers:    map[string]string{"Range": "bytes=0-4", "If-Range": `"stale"`},
+			wantStatus: 200,
+			wantBody:   "hello world",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			var err error
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				err = r2.SendFile(tt.path, tt.opts)
+			}
+			handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+			if tt.wantErr != 0 {
+				var fe *FileError
+				if !errors.As(err, &fe) || fe.StatusCode() != tt.wantErr {
+					t.Errorf("Response.SendFile() error = %v, want status %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Response.SendFile() error = %v", err)
+			}
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("Response.SendFile() = %v %q, want %v %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestResponse_SendFile_conditional(t *testing.T) {
+	root := t.TempDir()
+	ioutil.WriteFile(filepath.Join(root, "app.js"), []byte("console.log(1)"), 0644)
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		var handler HandlerFunc = func(r1 Request, r2 Response) {
+			r2.SendFile("app.js", FileOptions{Root: root, MaxAge: time.Hour, Immutable: true})
+		}
+		handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+		return w
+	}
+
+	w := serve(nil)
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("Response.SendFile() missing validators: %v", w.Header())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600, immutable" {
+		t.Errorf("Response.SendFile() Cache-Control = %v", got)
+	}
+	if got := w.Header().Get(HeaderContentType); !strings.HasPrefix(got, "text/javascript") && !strings.HasPrefix(got, "application/javascript") {
+		t.Errorf("Response.SendFile() Content-Type = %v", got)
+	}
+
+	if w := serve(map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("Response.SendFile() If-None-Match status = %v, want 304", w.Code)
+	}
+	if w := serve(map[string]string{"Range": "bytes=0-6", "If-Range": etag}); w.Code != 206 || w.Body.String() != "console" {
+		t.Errorf("Response.SendFile() If-Range = %v %q, want 206 console", w.Code, w.Body.String())
+	}
+}
+
+func TestResponse_SendReader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=6-")
+	w := httptest.NewRecorder()
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		r2.SendReader("report.csv", time.Time{}, strings.NewReader("a,b\n1,2\n"))
+	}
+	handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+	if w.Code != 206 || w.Body.String() != "2\n" {
+		t.Errorf("Response.SendReader() = %v %q, want 206 %q", w.Code, w.Body.String(), "2\n")
+	}
+	if got := w.Header().Get(HeaderContentType); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("Response.SendReader() Content-Type = %v", got)
+	}
+}
+
+func TestResponse_Attachment(t *testing.T) {
+	tests := []struct {
+		name            string
+		filename        []string
+		wantDisposition string
+		wantType        string
+	}{
+		{name: "no filename", wantDisposition: "attachment"},
+		{name: "ascii", filename: []string{"report.pdf"}, wantDisposition: `attachment; filename="report.pdf"`, wantType: "application/pdf"},
+		{name: "quotes", filename: []string{`say "hi".txt`}, wantDisposition: `attachment; filename="say \"hi\".txt"`, wantType: "text/plain; charset=utf-8"},
+		{
+			name:            "utf-8",
+			filename:        []string{"laporan €.png"},
+			wantDisposition: `attachment; filename="laporan ?.png"; filename*=UTF-8''laporan%20%E2%82%AC.png`,
+			wantType:        "image/png",
+		},
+		{name: "directories stripped", filename: []string{"../../etc/passwd"}, wantDisposition: `attachment; filename="passwd"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				r2.Attachment(tt.filename...)
+			}
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+			if got := w.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Response.Attachment() Content-Disposition = %v, want %v", got, tt.wantDisposition)
+			}
+			if got := w.Header().Get(HeaderContentType); got != tt.wantType {
+				t.Errorf("Response.Attachment() Content-Type = %v, want %v", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestResponse_Download(t *testing.T) {
+	root := t.TempDir()
+	ioutil.WriteFile(filepath.Join(root, "data.json"), []byte(`{"a":1}`), 0644)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=1-3")
+	w := httptest.NewRecorder()
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		if err := r2.Download("data.json", "", FileOptions{Root: root}); err != nil {
+			t.Errorf("Response.Download() error = %v", err)
+		}
+	}
+	handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+	if w.Code != 206 || w.Body.String() != `"a"` {
+		t.Errorf("Response.Download() = %v %q, want 206 %q", w.Code, w.Body.String(), `"a"`)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="data.json"` {
+		t.Errorf("Response.Download() Content-Disposition = %v", got)
+	}
+
+	w = httptest.NewRecorder()
+	handler = func(r1 Request, r2 Response) {
+		if err := r2.Download("missing.json", "x.json", FileOptions{Root: root}); err != nil {
+			r2.SendError(err)
+		}
+	}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+	if w.Code != 404 || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Response.Download() missing file = %v %v", w.Code, w.Header())
+	}
+}
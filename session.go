@@ -0,0 +1,434 @@
+package fastrex
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionName            = "sid"
+	defaultSessionIdleTimeout     = 30 * time.Minute
+	defaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+// SessionData is what a SessionStore keeps for one session.
+type SessionData struct {
+	ID       string                   `json:"id"`
+	Values   map[string]interface{}   `json:"values,omitempty"`
+	Flashes  map[string][]interface{} `json:"flashes,omitempty"`
+	Created  time.Time                `json:"created"`
+	LastSeen time.Time                `json:"last_seen"`
+}
+
+// SessionStore persists sessions between requests. Load returns nil without an error
+// for unknown values. Save returns the cookie value that refers to the session.
+type SessionStore interface {
+	Load(value string) (*SessionData, error)
+	Save(data *SessionData, ttl time.Duration) (string, error)
+	Delete(id string) error
+}
+
+// SessionOptions configures the Sessions middleware.
+type SessionOptions struct {
+	// Cookie is the template for the session cookie. Its value is replaced. Defaults to
+	// a cookie named "sid" with path "/", HttpOnly and SameSite=Lax.
+	Cookie *Cookie
+	// IdleTimeout ends sessions that have not been used for this long. Defaults to 30 minutes.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout ends sessions this long after they were created. Defaults to 24 hours.
+	AbsoluteTimeout time.Duration
+}
+
+// Session holds the values of one client across requests. It is safe for concurrent use.
+type Session struct {
+	mu        sync.Mutex
+	data      *SessionData
+	store     SessionStore
+	opts      SessionOptions
+	res       Response
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldID     string
+	saved     bool
+}
+
+// Sessions returns a middleware that loads the session for every request, see
+// Request.Session. The session is saved when the response header is written, so
+// changes made after the response has started are lost; call Session.Save first to
+// handle store errors.
+func Sessions(store SessionStore, opts ...SessionOptions) Middleware {
+	opt := SessionOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Cookie == nil {
+		c := &Cookie{}
+		c.Name(defaultSessionName).Path("/").HttpOnly(true).SameSite(http.SameSiteLaxMode)
+		opt.Cookie = c
+	}
+	if opt.IdleTimeout <= 0 {
+		opt.IdleTimeout = defaultSessionIdleTimeout
+	}
+	if opt.AbsoluteTimeout <= 0 {
+		opt.AbsoluteTimeout = defaultSessionAbsoluteTimeout
+	}
+
+	return func(req Request, res Response, next Next) {
+		s := &Session{store: store, opts: opt, res: res}
+		if c, err := req.Cookie(opt.Cookie.GetName()); err == nil && c.GetValue() != "" {
+			data, err := store.Load(c.GetValue())
+			if err != nil {
+				next(req.ErrorMiddleware(err, http.StatusInternalServerError), res)
+				return
+			}
+			if data != nil && s.expired(data, time.Now()) {
+				if err := store.Delete(data.ID); err != nil {
+					next(req.ErrorMiddleware(err, http.StatusInternalServerError), res)
+					return
+				}
+				data = nil
+			}
+			s.data = data
+		}
+		if s.data == nil {
+			s.data = &SessionData{ID: newSessionID(), Created: time.Now()}
+			s.isNew = true
+		}
+		if s.data.Values == nil {
+			s.data.Values = map[string]interface{}{}
+		}
+		if s.data.Flashes == nil {
+			s.data.Flashes = map[string][]interface{}{}
+		}
+
+		if req.state != nil {
+			req.state.session = s
+			req.state.cookies.onWrite(func() error {
+				if err := s.Save(); err != nil {
+					return fmt.Errorf("session error: %w", err)
+				}
+				return nil
+			})
+		}
+		next(req, res)
+	}
+}
+
+// Session returns the session loaded by the Sessions middleware, or nil without it.
+func (h *Request) Session() *Session {
+	if h.state == nil {
+		return nil
+	}
+	return h.state.session
+}
+
+func (s *Session) expired(data *SessionData, now time.Time) bool {
+	return now.Sub(data.LastSeen) > s.opts.IdleTimeout || now.Sub(data.Created) > s.opts.AbsoluteTimeout
+}
+
+// ID returns the session ID. It changes after Regenerate.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.ID
+}
+
+// IsNew reports whether the session was created by this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get returns the value stored under key, or nil.
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Values[key]
+}
+
+// Set stores value under key.
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Values[key] = value
+	s.modified = true
+}
+
+// Delete removes the value stored under key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Values, key)
+	s.modified = true
+}
+
+// Flash adds a message that is kept until it is read with Flashes, usually on the
+// next request.
+func (s *Session) Flash(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Flashes[key] = append(s.data.Flashes[key], value)
+	s.modified = true
+}
+
+// Flashes returns and removes the messages added with Flash under key.
+func (s *Session) Flashes(key string) []interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	flashes, ok := s.data.Flashes[key]
+	if ok {
+		delete(s.data.Flashes, key)
+		s.modified = true
+	}
+	return flashes
+}
+
+// Regenerate gives the session a new ID and keeps its values. Call it when the
+// privilege level changes, such as on login, to prevent session fixation.
+func (s *Session) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.data.ID
+	}
+	s.data.ID = newSessionID()
+	s.modified = true
+}
+
+// Destroy removes the session from the store and clears the session cookie.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.destroyed = true
+}
+
+// Save writes the session to the store and sets the session cookie. It is called
+// automatically before the response header is written and does nothing when called again.
+func (s *Session) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved {
+		return nil
+	}
+	s.saved = true
+
+	c := *s.opts.Cookie
+	if s.destroyed {
+		if s.isNew {
+			return nil
+		}
+		if s.oldID != "" {
+			if err := s.store.Delete(s.oldID); err != nil {
+				return err
+			}
+		}
+		if err := s.store.Delete(s.data.ID); err != nil {
+			return err
+		}
+		s.res.ClearCookie(c.GetName(), c.GetPath(), c.GetDomain())
+		return nil
+	}
+	// Empty new sessions are not stored, which keeps anonymous traffic out of the store.
+	if s.isNew && !s.modified {
+		return nil
+	}
+	if s.oldID != "" {
+		if err := s.store.Delete(s.oldID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.data.LastSeen = now
+	ttl := s.opts.IdleTimeout
+	if remaining := s.data.Created.Add(s.opts.AbsoluteTimeout).Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	value, err := s.store.Save(s.data, ttl)
+	if err != nil {
+		return err
+	}
+	c.Value(value).MaxAge(int(ttl / time.Second))
+	s.res.Cookie(c)
+	return nil
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// MemorySessionStore keeps sessions in memory. Expired sessions are removed by a
+// background sweep until Close is called.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	done     chan struct{}
+	once     sync.Once
+}
+
+type memorySession struct {
+	data    SessionData
+	expires time.Time
+}
+
+// NewMemorySessionStore returns a store that sweeps expired sessions every interval.
+// A zero interval defaults to one minute.
+func NewMemorySessionStore(interval time.Duration) *MemorySessionStore {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	m := &MemorySessionStore{sessions: map[string]memorySession{}, done: make(chan struct{})}
+	go m.sweep(interval)
+	return m
+}
+
+func (m *MemorySessionStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for id, s := range m.sessions {
+				if now.After(s.expires) {
+					delete(m.sessions, id)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *MemorySessionStore) Load(value string) (*SessionData, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[value]
+	if !ok || time.Now().After(s.expires) {
+		return nil, nil
+	}
+	return copySessionData(s.data), nil
+}
+
+func (m *MemorySessionStore) Save(data *SessionData, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[data.ID] = memorySession{data: *copySessionData(*data), expires: time.Now().Add(ttl)}
+	return data.ID, nil
+}
+
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Len returns the number of stored sessions.
+func (m *MemorySessionStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Close stops the background sweep.
+func (m *MemorySessionStore) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return nil
+}
+
+// copySessionData keeps requests from sharing the maps held by the store.
+func copySessionData(data SessionData) *SessionData {
+	c := data
+	c.Values = make(map[string]interface{}, len(data.Values))
+	for k, v := range data.Values {
+		c.Values[k] = v
+	}
+	c.Flashes = make(map[string][]interface{}, len(data.Flashes))
+	for k, v := range data.Flashes {
+		c.Flashes[k] = append([]interface{}(nil), v...)
+	}
+	return &c
+}
+
+// cookieSessionStore keeps the whole session in the encrypted cookie value.
+type cookieSessionStore struct {
+	keys []cookieKey
+}
+
+// NewCookieSessionStore returns a store that keeps sessions in the session cookie,
+// encrypted with keys the same way as Response.EncryptedCookie. Values are encoded
+// as JSON, so numbers come back as float64. Browsers limit cookies to about 4KB.
+func NewCookieSessionStore(keys ...[]byte) SessionStore {
+	if len(keys) == 0 {
+		panic("session error: at least one key is required")
+	}
+	ring := make([]cookieKey, 0, len(keys))
+	for _, k := range keys {
+		key, err := newCookieKey(k)
+		if err != nil {
+			panic(err)
+		}
+		ring = append(ring, key)
+	}
+	return &cookieSessionStore{keys: ring}
+}
+
+var sessionAD = []byte("fastrex session")
+
+func (c *cookieSessionStore) Load(value string) (*SessionData, error) {
+	sealed, err := decodeCookie(value)
+	if err != nil {
+		return nil, nil
+	}
+	for _, key := range c.keys {
+		size := key.aead.NonceSize()
+		if len(sealed) < size {
+			return nil, nil
+		}
+		plain, err := key.aead.Open(nil, sealed[:size], sealed[size:], sessionAD)
+		if err != nil {
+			continue
+		}
+		data := &SessionData{}
+		if err := json.Unmarshal(plain, data); err != nil {
+			return nil, nil
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+func (c *cookieSessionStore) Save(data *SessionData, ttl time.Duration) (string, error) {
+	plain, err := json.Marshal(data)
+	if err != nil {
+		return "", errors.New("session error: " + err.Error())
+	}
+	aead := c.keys[0].aead
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return encodeCookie(aead.Seal(nonce, nonce, plain, sessionAD)), nil
+}
+
+// Delete does nothing; the cookie is cleared by the middleware.
+func (c *cookieSessionStore) Delete(id string) error {
+	return nil
+}
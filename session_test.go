@@ -0,0 +1,186 @@
+package fastrex
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionClient sends requests to app and keeps the session cookie between them.
+type sessionClient struct {
+	app    App
+	cookie *http.Cookie
+}
+
+func (c *sessionClient) get(t *testing.T, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if c.cookie != nil {
+		req.AddCookie(c.cookie)
+	}
+	w := httptest.NewRecorder()
+	c.app.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name != defaultSessionName {
+			continue
+		}
+		if cookie.MaxAge < 0 {
+			c.cookie = nil
+		} else {
+			c.cookie = cookie
+		}
+	}
+	return w
+}
+
+func newSessionApp(store SessionStore, opts ...SessionOptions) App {
+	app := New()
+	app.Use(Sessions(store, opts...))
+	app.Get("/login", func(req Request, res Response) {
+		s := req.Session()
+		s.Regenerate()
+		s.Set("user", "agus")
+		s.Flash("notice", "welcome")
+		res.Send(s.ID())
+	})
+	app.Get("/me", func(req Request, res Response) {
+		s := req.Session()
+		user, _ := s.Get("user").(string)
+		notice := ""
+		if f := s.Flashes("notice"); len(f) > 0 {
+			notice = f[0].(string)
+		}
+		res.Send(user + "|" + notice)
+	})
+	app.Get("/logout", func(req Request, res Response) {
+		req.Session().Destroy()
+		res.Send("bye")
+	})
+	return app
+}
+
+func TestSessions(t *testing.T) {
+	stores := map[string]func() SessionStore{
+		"memory": func() SessionStore { return NewMemorySessionStore(time.Minute) },
+		"cookie": func() SessionStore { return NewCookieSessionStore([]byte("session-secret-0123456789")) },
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := store()
+			if c, ok := s.(*MemorySessionStore); ok {
+				defer c.Close()
+			}
+			c := &sessionClient{app: newSessionApp(s)}
+
+			if w := c.get(t, "/me"); w.Body.String() != "|" || c.cookie != nil {
+				t.Fatalf("anonymous request = %q cookie %v, want empty session without cookie", w.Body.String(), c.cookie)
+			}
+			c.get(t, "/login")
+			if c.cookie == nil || !c.cookie.HttpOnly || c.cookie.Path != "/" {
+				t.Fatalf("login cookie = %v", c.cookie)
+			}
+			if w := c.get(t, "/me"); w.Body.String() != "agus|welcome" {
+				t.Errorf("first read = %q, want agus|welcome", w.Body.String())
+			}
+			if w := c.get(t, "/me"); w.Body.String() != "agus|" {
+				t.Errorf("flash read twice = %q, want agus|", w.Body.String())
+			}
+			c.get(t, "/logout")
+			if c.cookie != nil {
+				t.Errorf("logout kept cookie %v", c.cookie)
+			}
+		})
+	}
+}
+
+func TestSessions_regenerate(t *testing.T) {
+	store := NewMemorySessionStore(time.Minute)
+	defer store.Close()
+	c := &sessionClient{app: newSessionApp(store)}
+
+	c.get(t, "/login")
+	fixated := c.cookie
+	c.get(t, "/login")
+	if c.cookie.Value == fixated.Value {
+		t.Fatalf("Session.Regenerate() kept ID %v", fixated.Value)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Session.Regenerate() left %d sessions, want 1", store.Len())
+	}
+	old := &sessionClient{app: c.app, cookie: fixated}
+	if w := old.get(t, "/me"); w.Body.String() != "|" {
+		t.Errorf("old session ID still valid: %q", w.Body.String())
+	}
+}
+
+func TestSessions_timeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     SessionOptions
+		age      time.Duration
+		idle     time.Duration
+		wantUser string
+	}{
+		{name: "active", opts: SessionOptions{IdleTimeout: time.Hour}, idle: time.Minute, wantUser: "agus"},
+		{name: "idle", opts: SessionOptions{IdleTimeout: time.Hour}, idle: 2 * time.Hour},
+		{name: "absolute", opts: SessionOptions{IdleTimeout: time.Hour, AbsoluteTimeout: 2 * time.Hour}, age: 3 * time.Hour, idle: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemorySessionStore(time.Minute)
+			defer store.Close()
+			now := time.Now()
+			data := &SessionData{
+				ID:       "known",
+				Values:   map[string]interface{}{"user": "agus"},
+				Created:  now.Add(-tt.age - tt.idle),
+				LastSeen: now.Add(-tt.idle),
+			}
+			store.Save(data, time.Hour)
+			c := &sessionClient{app: newSessionApp(store, tt.opts), cookie: &http.Cookie{Name: defaultSessionName, Value: "known"}}
+			if w := c.get(t, "/me"); w.Body.String() != tt.wantUser+"|" {
+				t.Errorf("Sessions() = %q, want %q", w.Body.String(), tt.wantUser+"|")
+			}
+		})
+	}
+}
+
+func TestMemorySessionStore_sweep(t *testing.T) {
+	store := NewMemorySessionStore(5 * time.Millisecond)
+	defer store.Close()
+	store.Save(&SessionData{ID: "a"}, time.Millisecond)
+	store.Save(&SessionData{ID: "b"}, time.Hour)
+	deadline := time.Now().Add(time.Second)
+	for store.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if store.Len() != 1 {
+		t.Errorf("MemorySessionStore.Len() = %d after sweep, want 1", store.Len())
+	}
+}
+
+// failingStore is a SessionStore that can not save.
+type failingStore struct {
+	SessionStore
+}
+
+func (failingStore) Save(data *SessionData, ttl time.Duration) (string, error) {
+	return "", errors.New("store down")
+}
+
+func TestSessions_saveError(t *testing.T) {
+	var logs bytes.Buffer
+	app := newSessionApp(failingStore{NewMemorySessionStore(time.Minute)})
+	app.Log(log.New(&logs, "", 0))
+	w := (&sessionClient{app: app}).get(t, "/login")
+	if !strings.Contains(logs.String(), "session error: store down") {
+		t.Errorf("Session.Save() error not logged: %q", logs.String())
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Errorf("session cookie sent although the session was not saved")
+	}
+}
@@ -0,0 +1,189 @@
+package fastrex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSSEHeartbeat = 15 * time.Second
+
+// ErrStreamClosed is returned by EventStream methods after Close.
+var ErrStreamClosed = errors.New("event stream closed")
+
+// SSEOptions configures Response.SSE.
+type SSEOptions struct {
+	// Heartbeat is how often a comment is sent to keep proxies from closing an idle
+	// stream. Defaults to 15 seconds; a negative value disables it.
+	Heartbeat time.Duration
+	// Retry, when set, tells the client how long to wait before reconnecting.
+	Retry time.Duration
+}
+
+// EventStream writes server-sent events. Every write is flushed to the client. It
+// is safe for concurrent use, and is closed when the handler returns.
+type EventStream struct {
+	mu      sync.Mutex
+	w       *responseWriter
+	ctx     context.Context
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	closed  bool
+}
+
+// SSE starts an event stream. It returns http.ErrNotSupported when the writer can
+// not flush.
+func (h *httpResponse) SSE(opts ...SSEOptions) (*EventStream, error) {
+	opt := SSEOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.Heartbeat == 0 {
+		opt.Heartbeat = defaultSSEHeartbeat
+	}
+
+	w := h.writer()
+	header := w.Header()
+	header.Set(HeaderContentType, "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	if h.r.ProtoMajor == 1 {
+		header.Set("Connection", "keep-alive")
+	}
+	if err := w.flush(http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	s := &EventStream{w: w, ctx: h.r.Context(), done: make(chan struct{}), stopped: make(chan struct{})}
+	if opt.Retry > 0 {
+		if err := s.Retry(opt.Retry); err != nil {
+			return nil, err
+		}
+	}
+	go s.watch(opt.Heartbeat)
+	h.state.onEnd(func() { s.Close() })
+	return s, nil
+}
+
+// watch sends heartbeats and closes the stream when the request ends.
+func (s *EventStream) watch(heartbeat time.Duration) {
+	defer close(s.stopped)
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.ctx.Done():
+			s.close()
+			return
+		case <-tick:
+			s.Comment("heartbeat")
+		}
+	}
+}
+
+// Event sends an event. Strings and byte slices are sent as they are, other data is
+// encoded as JSON. An empty name sends an unnamed "message" event and an empty id
+// leaves the last event ID unchanged. Each line of the data, ended by CRLF, CR or LF,
+// becomes its own data field.
+func (s *EventStream) Event(name string, data interface{}, id string) error {
+	if strings.ContainsAny(name, "\r\n") || strings.ContainsAny(id, "\r\n\x00") {
+		return errors.New("sse error: event name and id must be a single line")
+	}
+	var payload []byte
+	switch d := data.(type) {
+	case string:
+		payload = []byte(d)
+	case []byte:
+		payload = d
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		payload = b
+	}
+
+	buf := &bytes.Buffer{}
+	if id != "" {
+		buf.WriteString("id: " + id + "\n")
+	}
+	if name != "" {
+		buf.WriteString("event: " + name + "\n")
+	}
+	payload = bytes.ReplaceAll(payload, []byte("\r\n"), []byte("\n"))
+	payload = bytes.ReplaceAll(payload, []byte("\r"), []byte("\n"))
+	for _, line := range bytes.Split(payload, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n"))
+}
+
+// Comment sends a comment line, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	text = strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+	return s.write([]byte(": " + text + "\n\n"))
+}
+
+func (s *EventStream) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// Done is closed when the stream is closed or the client goes away.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops the heartbeat and waits for it to end. Later writes return
+// ErrStreamClosed.
+func (s *EventStream) Close() error {
+	s.close()
+	<-s.stopped
+	return nil
+}
+
+func (s *EventStream) close() {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		close(s.done)
+	})
+}
+
+// LastEventID returns the ID of the last event the client received before it
+// reconnected, so the stream can resume after it.
+func (h *Request) LastEventID() string {
+	return h.Header.Get("Last-Event-ID")
+}
@@ -0,0 +1,183 @@
+package fastrex
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponse_SSE(t *testing.T) {
+	app := New()
+	app.Get("/events", func(req Request, res Response) {
+		stream, err := res.SSE(SSEOptions{Retry: 3 * time.Second, Heartbeat: -1})
+		if err != nil {
+			t.Errorf("Response.SSE() error = %v", err)
+			return
+		}
+		defer stream.Close()
+		stream.Event("", "resume after "+req.LastEventID(), "")
+		stream.Event("progress", map[string]int{"done": 50}, "7")
+		stream.Event("log", "line 1\nline 2", "")
+		stream.Event("", "hi\revent: evil\r\ndata: x", "")
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "6")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	if got := resp.Header.Get(HeaderContentType); got != "text/event-stream; charset=utf-8" {
+		t.Errorf("Response.SSE() Content-Type = %v", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Response.SSE() Cache-Control = %v", got)
+	}
+	want := "retry: 3000\n\n" +
+		"data: resume after 6\n\n" +
+		"id: 7\nevent: progress\ndata: {\"done\":50}\n\n" +
+		"event: log\ndata: line 1\ndata: line 2\n\n" +
+		"data: hi\ndata: event: evil\ndata: data: x\n\n"
+	if string(body) != want {
+		t.Errorf("Response.SSE() body = %q, want %q", body, want)
+	}
+}
+
+func TestResponse_SSE_heartbeat(t *testing.T) {
+	app := New()
+	app.Get("/", func(req Request, res Response) {
+		stream, err := res.SSE(SSEOptions{Heartbeat: 5 * time.Millisecond})
+		if err != nil {
+			t.Errorf("Response.SSE() error = %v", err)
+			return
+		}
+		defer stream.Close()
+		time.Sleep(50 * time.Millisecond)
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if line != ": heartbeat\n" {
+		t.Errorf("Response.SSE() first line = %q, want heartbeat comment", line)
+	}
+}
+
+func TestResponse_SSE_cancel(t *testing.T) {
+	stopped := make(chan error, 1)
+	app := New()
+	app.Get("/", func(req Request, res Response) {
+		stream, err := res.SSE()
+		if err != nil {
+			stopped <- err
+			return
+		}
+		defer stream.Close()
+		for {
+			if err := stream.Event("tick", "x", ""); err != nil {
+				stopped <- err
+				return
+			}
+			select {
+			case <-stream.Done():
+			case <-time.After(time.Millisecond):
+			}
+		}
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if !strings.HasPrefix(line, "event: tick") {
+		t.Errorf("Response.SSE() first line = %q", line)
+	}
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Errorf("EventStream.Event() after disconnect returned nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("EventStream did not stop after the client went away")
+	}
+}
+
+func TestResponse_SSE_closedOnReturn(t *testing.T) {
+	streams := make(chan *EventStream, 1)
+	// App.Ctx replaces the request context, so it is never canceled.
+	app := New().Ctx(context.Background())
+	app.Get("/", func(req Request, res Response) {
+		stream, err := res.SSE(SSEOptions{Heartbeat: time.Millisecond})
+		if err != nil {
+			t.Errorf("Response.SSE() error = %v", err)
+			return
+		}
+		stream.Event("", "hi", "")
+		streams <- stream
+	})
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	stream := <-streams
+	select {
+	case <-stream.Done():
+	default:
+		t.Fatal("EventStream is open after the handler returned")
+	}
+	body := w.Body.String()
+	time.Sleep(10 * time.Millisecond)
+	if w.Body.String() != body {
+		t.Errorf("EventStream wrote after the handler returned: %q", w.Body.String())
+	}
+	if err := stream.Event("", "late", ""); err != ErrStreamClosed {
+		t.Errorf("EventStream.Event() after return = %v, want ErrStreamClosed", err)
+	}
+}
+
+func TestResponse_SSE_unsupported(t *testing.T) {
+	// Embedding the interface hides the recorder's Flush and there is no Unwrap.
+	type plainWriter struct{ http.ResponseWriter }
+	tests := []struct {
+		name    string
+		w       http.ResponseWriter
+		wantErr error
+	}{
+		{name: "unwrapped", w: &wrappingWriter{w: httptest.NewRecorder()}},
+		{name: "no flusher", w: plainWriter{httptest.NewRecorder()}, wantErr: http.ErrNotSupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				_, err = r2.SSE()
+			}
+			handler.ServeHTTP(tt.w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+			if err != tt.wantErr {
+				t.Errorf("Response.SSE() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package fastrex
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"time"
+)
+
+const (
+	MimeApplicationNDJSON = "application/x-ndjson"
+	defaultStreamFlush    = time.Second
+)
+
+// StreamIterator yields the items of a stream, one per call, and returns io.EOF
+// after the last one. It should return early when the request context is done.
+type StreamIterator func() (interface{}, error)
+
+// StreamOptions configures Response.StreamNDJSON and Response.StreamJSONArray.
+type StreamOptions struct {
+	// FlushInterval is the longest time written items stay buffered while the source
+	// keeps producing. Items are also flushed whenever a channel source has nothing
+	// ready. Defaults to one second; a negative value flushes after every item.
+	FlushInterval time.Duration
+}
+
+// StreamNDJSON sends every item of source, a StreamIterator or a channel, as one line
+// of JSON.
+func (h *httpResponse) StreamNDJSON(source interface{}, opts ...StreamOptions) error {
+	return h.stream(source, opts, MimeApplicationNDJSON, "", "", "\n", "")
+}
+
+// StreamJSONArray sends the items of source, a StreamIterator or a channel, as the
+// elements of a JSON array.
+func (h *httpResponse) StreamJSONArray(source interface{}, opts ...StreamOptions) error {
+	return h.stream(source, opts, MimeApplicationJson, "[", ",", "", "]")
+}
+
+// stream writes open, then each item followed by suffix and separated by sep, then
+// end. Errors before anything is written are sent with SendError; later ones end
+// the response early, which leaves a JSON array unterminated so clients notice.
+func (h *httpResponse) stream(source interface{}, opts []StreamOptions, contentType, open, sep, suffix, end string) error {
+	opt := StreamOptions{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.FlushInterval == 0 {
+		opt.FlushInterval = defaultStreamFlush
+	}
+	ctx := h.r.Context()
+	next, err := streamSource(source, ctx.Done())
+	if err != nil {
+		h.SendError(err)
+		return err
+	}
+	encode := h.jsonOptions()
+	encode.Prefix, encode.Indent = "", ""
+
+	w := h.writer()
+	fail := func(err error) error {
+		if !w.wroteHeader {
+			h.SendError(err)
+		}
+		return err
+	}
+	start := func() {
+		if !w.wroteHeader {
+			w.Header().Set(HeaderContentType, contentType)
+			w.WriteHeader(h.s)
+		}
+	}
+	write := func(s string) error {
+		start()
+		_, err := w.Write([]byte(s))
+		return err
+	}
+	flush := func() {
+		start()
+		w.Flush()
+	}
+
+	lastFlush := time.Now()
+	first := true
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		item, ready, err := next(false)
+		if !ready {
+			flush()
+			lastFlush = time.Now()
+			item, _, err = next(true)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err == errStreamCanceled {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fail(err)
+		}
+		data, err := encode.marshal(item)
+		if err != nil {
+			return fail(err)
+		}
+		s := string(data) + suffix
+		if first {
+			s = open + s
+			first = false
+		} else {
+			s = sep + s
+		}
+		if err := write(s); err != nil {
+			return err
+		}
+		if time.Since(lastFlush) >= opt.FlushInterval {
+			flush()
+			lastFlush = time.Now()
+		}
+	}
+	if first {
+		end = open + end
+	}
+	if err := write(end); err != nil {
+		return err
+	}
+	flush()
+	return nil
+}
+
+// streamSource returns a function reading the next item of source. When block is
+// false a channel source reports whether an item was ready instead of waiting.
+func streamSource(source interface{}, done <-chan struct{}) (func(block bool) (interface{}, bool, error), error) {
+	switch it := source.(type) {
+	case StreamIterator:
+		return func(bool) (interface{}, bool, error) {
+			v, err := it()
+			return v, true, err
+		}, nil
+	case func() (interface{}, error):
+		return streamSource(StreamIterator(it), done)
+	}
+
+	ch := reflect.ValueOf(source)
+	if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, errors.New("stream error: source must be a StreamIterator or a receivable channel")
+	}
+	return func(block bool) (interface{}, bool, error) {
+		cases := []reflect.SelectCase{{Dir: reflect.SelectRecv, Chan: ch}}
+		if block {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)})
+		} else {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+		}
+		chosen, v, ok := reflect.Select(cases)
+		switch {
+		case chosen == 1 && !block:
+			return nil, false, nil
+		case chosen == 1:
+			return nil, true, errStreamCanceled
+		case !ok:
+			return nil, true, io.EOF
+		}
+		return v.Interface(), true, nil
+	}, nil
+}
+
+// errStreamCanceled stops a stream when the request context is done while waiting
+// on a channel. stream reports the context error instead.
+var errStreamCanceled = errors.New("stream canceled")
@@ -0,0 +1,186 @@
+package fastrex
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func sliceIterator(items ...interface{}) StreamIterator {
+	return func() (interface{}, error) {
+		if len(items) == 0 {
+			return nil, io.EOF
+		}
+		item := items[0]
+		items = items[1:]
+		return item, nil
+	}
+}
+
+func Test_httpResponse_Stream(t *testing.T) {
+	type row struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	tests := []struct {
+		name       string
+		handler    HandlerFunc
+		wantStatus int
+		wantType   string
+		wantBody   string
+		wantErr    bool
+	}{
+		{
+			name: "ndjson iterator",
+			handler: func(r1 Request, r2 Response) {
+				r2.StreamNDJSON(sliceIterator(row{1, "a"}, row{2, "b"}))
+			},
+			wantStatus: 200,
+			wantType:   MimeApplicationNDJSON,
+			wantBody:   "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"b\"}\n",
+		},
+		{
+			name: "array channel",
+			handler: func(r1 Request, r2 Response) {
+				ch := make(chan row, 2)
+				ch <- row{1, "a"}
+				ch <- row{2, "b"}
+				close(ch)
+				r2.Status(206).StreamJSONArray(ch)
+			},
+			wantStatus: 206,
+			wantType:   MimeApplicationJson,
+			wantBody:   `[{"id":1,"name":"a"},{"id":2,"name":"b"}]`,
+		},
+		{
+			name: "empty array",
+			handler: func(r1 Request, r2 Response) {
+				r2.StreamJSONArray(sliceIterator())
+			},
+			wantStatus: 200,
+			wantType:   MimeApplicationJson,
+			wantBody:   `[]`,
+		},
+		{
+			name: "iterator error before first item",
+			handler: func(r1 Request, r2 Response) {
+				r2.StreamJSONArray(StreamIterator(func() (interface{}, error) {
+					return nil, &statusError{code: 503, err: errors.New("database unavailable")}
+				}))
+			},
+			wantStatus: 503,
+			wantType:   MimeApplicationJson,
+			wantBody:   `{"message":"Service Unavailable"}`,
+		},
+		{
+			name: "iterator error after first item",
+			handler: func(r1 Request, r2 Response) {
+				sent := false
+				r2.StreamJSONArray(func() (interface{}, error) {
+					if sent {
+						return nil, errors.New("lost connection")
+					}
+					sent = true
+					return 1, nil
+				})
+			},
+			wantStatus: 200,
+			wantType:   MimeApplicationJson,
+			wantBody:   `[1`,
+		},
+		{
+			name: "invalid source",
+			handler: func(r1 Request, r2 Response) {
+				r2.StreamNDJSON([]int{1, 2})
+			},
+			wantStatus: 500,
+			wantType:   MimeApplicationJson,
+			wantBody:   `{"message":"Internal Server Error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get(HeaderContentType); got != tt.wantType {
+				t.Errorf("Content-Type = %v, want %v", got, tt.wantType)
+			}
+			if got := w.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_httpResponse_Stream_flush(t *testing.T) {
+	// The first item must reach the client while the channel is still open.
+	release := make(chan struct{})
+	app := New()
+	app.Get("/", func(req Request, res Response) {
+		ch := make(chan int)
+		go func() {
+			defer close(ch)
+			ch <- 1
+			<-release
+			ch <- 2
+		}()
+		res.StreamNDJSON(ch)
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	br := bufio.NewReader(resp.Body)
+	if line, _ := br.ReadString('\n'); line != "1\n" {
+		t.Errorf("first line = %q, want 1", line)
+	}
+	close(release)
+	if line, _ := br.ReadString('\n'); line != "2\n" {
+		t.Errorf("second line = %q, want 2", line)
+	}
+}
+
+func Test_httpResponse_Stream_cancel(t *testing.T) {
+	stopped := make(chan error, 1)
+	app := New()
+	app.Get("/", func(req Request, res Response) {
+		ch := make(chan int)
+		go func() {
+			ch <- 1
+		}()
+		stopped <- res.StreamNDJSON(ch)
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufio.NewReader(resp.Body).ReadString('\n')
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("Response.StreamNDJSON() = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop after the client went away")
+	}
+}
@@ -0,0 +1,446 @@
+package fastrex
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	sniffLen            = 512
+	defaultMaxFieldSize = 1 << 20
+)
+
+var (
+	// ErrFileTooLarge is reported for a part larger than UploadOptions.MaxFileSize.
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrUploadTooLarge is returned when the body exceeds UploadOptions.MaxTotalSize.
+	ErrUploadTooLarge = errors.New("upload too large")
+	// ErrTooManyFiles is reported for files beyond UploadOptions.MaxFiles.
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrFileType is reported for a part whose sniffed type is not allowed.
+	ErrFileType = errors.New("file type not allowed")
+	// ErrFieldTooLarge is returned for a non-file field larger than UploadOptions.MaxFieldSize.
+	ErrFieldTooLarge = errors.New("field too large")
+)
+
+// UploadOptions limits what Request.Uploads accepts. Zero values mean no limit,
+// except for MaxFieldSize.
+type UploadOptions struct {
+	MaxFileSize  int64
+	MaxTotalSize int64
+	MaxFiles     int
+	// MaxFieldSize limits each non-file field kept in Uploads.Values. Defaults to
+	// 1 MB; a negative value means no limit.
+	MaxFieldSize int64
+	// AllowedTypes lists the accepted MIME types as detected from the file content,
+	// for example "image/png" or "image/*".
+	AllowedTypes []string
+}
+
+// UploadError describes why a part or the whole upload was rejected.
+type UploadError struct {
+	Field    string
+	Filename string
+	Err      error
+}
+
+func (e *UploadError) Error() string {
+	if e.Filename == "" {
+		return "upload error: " + e.Err.Error()
+	}
+	return "upload error: " + strconv.Quote(e.Filename) + ": " + e.Err.Error()
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode ...
+func (e *UploadError) StatusCode() int {
+	switch {
+	case errors.Is(e.Err, ErrFileTooLarge), errors.Is(e.Err, ErrUploadTooLarge), errors.Is(e.Err, ErrTooManyFiles),
+		errors.Is(e.Err, ErrFieldTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(e.Err, ErrFileType):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// Storage saves uploaded files. Save must not keep partial content when r returns an
+// error, and returns the name the file was stored under.
+type Storage interface {
+	Save(name string, r io.Reader) (string, error)
+}
+
+// UploadedFile is the result of saving one file part.
+type UploadedFile struct {
+	Field       string
+	Filename    string
+	StoredName  string
+	ContentType string
+	Size        int64
+	Err         error
+}
+
+// UploadPart is a file part being streamed from the request body. Reading a part
+// returned with an error returns that error.
+type UploadPart struct {
+	Field       string
+	Filename    string
+	ContentType string
+	r           io.Reader
+	err         error
+	size        int64
+}
+
+func (p *UploadPart) Read(b []byte) (int, error) {
+	if p.r == nil {
+		return 0, p.err
+	}
+	n, err := p.r.Read(b)
+	p.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes read so far.
+func (p *UploadPart) Size() int64 {
+	return p.size
+}
+
+// Uploads streams the file parts of a multipart/form-data request.
+type Uploads struct {
+	// Values holds the non-file fields read so far.
+	Values url.Values
+	reader *multipart.Reader
+	body   *countingReader
+	opts   UploadOptions
+	files  int
+}
+
+// Uploads starts streaming the multipart body without buffering it in memory or on disk.
+func (h *Request) Uploads(opts UploadOptions) (*Uploads, error) {
+	mediaType, params, err := mime.ParseMediaType(h.Header.Get(HeaderContentType))
+	if err != nil || (mediaType != "multipart/form-data" && mediaType != "multipart/mixed") {
+		return nil, http.ErrNotMultipart
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		return nil, http.ErrMissingBoundary
+	}
+	body := &countingReader{r: h.Body, limit: opts.MaxTotalSize}
+	return &Uploads{
+		Values: url.Values{},
+		reader: multipart.NewReader(body, boundary),
+		body:   body,
+		opts:   opts,
+	}, nil
+}
+
+// Next returns the next file part, or io.EOF when there are no more. Non-file fields
+// are collected in Values. A file part that breaks a limit is returned with an
+// *UploadError; the caller may skip it and call Next again. A field over MaxFieldSize
+// or a body over MaxTotalSize ends the upload and is returned with a nil part.
+func (u *Uploads) Next() (*UploadPart, error) {
+	for {
+		part, err := u.reader.NextPart()
+		if err != nil {
+			if u.body.exceeded {
+				return nil, &UploadError{Err: ErrUploadTooLarge}
+			}
+			return nil, err
+		}
+		if part.FileName() == "" {
+			value, err := u.readField(part)
+			if err != nil {
+				return nil, err
+			}
+			u.Values.Add(part.FormName(), string(value))
+			continue
+		}
+
+		p := &UploadPart{Field: part.FormName(), Filename: SanitizeFilename(part.FileName())}
+		reject := func(err error) (*UploadPart, error) {
+			p.err = err
+			return p, err
+		}
+		u.files++
+		if u.opts.MaxFiles > 0 && u.files > u.opts.MaxFiles {
+			return reject(&UploadError{Field: p.Field, Filename: p.Filename, Err: ErrTooManyFiles})
+		}
+
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(part, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			if u.body.exceeded {
+				return nil, &UploadError{Err: ErrUploadTooLarge}
+			}
+			return reject(err)
+		}
+		head = head[:n]
+		p.ContentType = http.DetectContentType(head)
+		if !allowedType(p.ContentType, u.opts.AllowedTypes) {
+			return reject(&UploadError{Field: p.Field, Filename: p.Filename, Err: ErrFileType})
+		}
+		p.r = &partReader{
+			r:      io.MultiReader(bytes.NewReader(head), part),
+			limit:  u.opts.MaxFileSize,
+			body:   u.body,
+			upload: &UploadError{Field: p.Field, Filename: p.Filename},
+		}
+		return p, nil
+	}
+}
+
+// readField reads a non-file field up to MaxFieldSize.
+func (u *Uploads) readField(part *multipart.Part) ([]byte, error) {
+	limit := u.opts.MaxFieldSize
+	if limit == 0 {
+		limit = defaultMaxFieldSize
+	}
+	var r io.Reader = part
+	if limit > 0 {
+		r = io.LimitReader(part, limit+1)
+	}
+	value, err := ioutil.ReadAll(r)
+	if err != nil {
+		if u.body.exceeded {
+			return nil, &UploadError{Err: ErrUploadTooLarge}
+		}
+		return nil, err
+	}
+	if limit > 0 && int64(len(value)) > limit {
+		return nil, &UploadError{Field: part.FormName(), Err: ErrFieldTooLarge}
+	}
+	return value, nil
+}
+
+// SaveTo streams every file part into storage. Parts that break a limit are skipped and
+// reported in the result; the returned error is the first failure.
+func (u *Uploads) SaveTo(storage Storage) ([]UploadedFile, error) {
+	files := []UploadedFile{}
+	var first error
+	for {
+		part, err := u.Next()
+		if err == io.EOF {
+			return files, first
+		}
+		if part == nil {
+			if first == nil {
+				first = err
+			}
+			return files, first
+		}
+		f := UploadedFile{Field: part.Field, Filename: part.Filename, ContentType: part.ContentType}
+		if err == nil {
+			f.StoredName, err = storage.Save(part.Filename, part)
+			f.Size = part.Size()
+		}
+		if err != nil {
+			f.Err = err
+			if first == nil {
+				first = err
+			}
+		}
+		files = append(files, f)
+		if u.body.exceeded {
+			return files, first
+		}
+	}
+}
+
+func allowedType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType := normalizeType(contentType)
+	for _, a := range allowed {
+		if matchMediaType(normalizeType(a), mediaType) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeFilename strips directories, control characters and characters that are unsafe
+// in file names from a client supplied name.
+func SanitizeFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '-', r == '_':
+			return r
+		case unicode.IsSpace(r):
+			return '_'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		cut := 255 - len(ext)
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut] + ext
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// countingReader enforces the total body limit.
+type countingReader struct {
+	r        io.Reader
+	limit    int64
+	n        int64
+	exceeded bool
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	if c.exceeded {
+		return 0, ErrUploadTooLarge
+	}
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	if c.limit > 0 && c.n > c.limit {
+		c.exceeded = true
+		return n, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+// partReader enforces the per-file limit.
+type partReader struct {
+	r      io.Reader
+	limit  int64
+	n      int64
+	body   *countingReader
+	upload *UploadError
+}
+
+func (p *partReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if p.body.exceeded {
+		p.upload.Err = ErrUploadTooLarge
+		return n, p.upload
+	}
+	if p.limit > 0 && p.n > p.limit {
+		p.upload.Err = ErrFileTooLarge
+		return n, p.upload
+	}
+	return n, err
+}
+
+type dirStorage struct {
+	dir string
+}
+
+// NewDirStorage returns a Storage that writes files into dir. Existing files are never
+// overwritten; a numeric suffix is added instead.
+func NewDirStorage(dir string) Storage {
+	return &dirStorage{dir: dir}
+}
+
+func (d *dirStorage) Save(name string, r io.Reader) (string, error) {
+	tmp, err := ioutil.TempFile(d.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	name = SanitizeFilename(name)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		stored := name
+		if i > 0 {
+			stored = base + "-" + strconv.Itoa(i) + ext
+		}
+		target := filepath.Join(d.dir, stored)
+		// Link fails when target exists, which keeps concurrent uploads from
+		// replacing each other.
+		if err := os.Link(tmp.Name(), target); err == nil {
+			os.Remove(tmp.Name())
+			return stored, nil
+		} else if !os.IsExist(err) {
+			os.Remove(tmp.Name())
+			return "", err
+		}
+	}
+}
+
+// MemoryStorage keeps uploaded files in memory. It is meant for tests and small files.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryStorage ...
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: map[string][]byte{}}
+}
+
+func (m *MemoryStorage) Save(name string, r io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := name
+	for i := 1; ; i++ {
+		if _, ok := m.files[stored]; !ok {
+			break
+		}
+		ext := filepath.Ext(name)
+		stored = strings.TrimSuffix(name, ext) + "-" + strconv.Itoa(i) + ext
+	}
+	m.files[stored] = data
+	return stored, nil
+}
+
+// Get returns the content stored under name.
+func (m *MemoryStorage) Get(name string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.files[name]
+	return data, ok
+}
+
+// Len returns the number of stored files.
+func (m *MemoryStorage) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.files)
+}
@@ -0,0 +1,184 @@
+package fastrex
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+type uploadPart struct {
+	field    string
+	filename string
+	content  []byte
+}
+
+func newUploadRequest(t *testing.T, parts []uploadPart) *Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, p := range parts {
+		if p.filename == "" {
+			writer.WriteField(p.field, string(p.content))
+			continue
+		}
+		w, err := writer.CreateFormFile(p.field, p.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(p.content)
+	}
+	writer.Close()
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return newRequest(req, nil, false, map[string]interface{}{})
+}
+
+func TestRequest_Uploads_SaveTo(t *testing.T) {
+	big := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte("x"), 2048)...)
+	req := newUploadRequest(t, []uploadPart{
+		{field: "title", content: []byte("holiday")},
+		{field: "photo", filename: "../../etc/a b.png", content: append(append([]byte{}, pngHeader...), "data"...)},
+		{field: "photo", filename: "big.png", content: big},
+		{field: "doc", filename: "notes.txt", content: []byte("plain text")},
+		{field: "photo", filename: "a b.png", content: pngHeader},
+	})
+	uploads, err := req.Uploads(UploadOptions{MaxFileSize: 1024, AllowedTypes: []string{"image/*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := NewMemoryStorage()
+	files, err := uploads.SaveTo(storage)
+	if err == nil {
+		t.Errorf("Uploads.SaveTo() error = nil, want the first part error")
+	}
+	if got := uploads.Values.Get("title"); got != "holiday" {
+		t.Errorf("Uploads.Values = %v, want holiday", got)
+	}
+	if len(files) != 4 {
+		t.Fatalf("Uploads.SaveTo() returned %d files, want 4", len(files))
+	}
+
+	if files[0].Err != nil || files[0].StoredName != "a_b.png" || files[0].ContentType != "image/png" || files[0].Size != 12 {
+		t.Errorf("Uploads.SaveTo() first file = %+v", files[0])
+	}
+	var ue *UploadError
+	if !errors.Is(files[1].Err, ErrFileTooLarge) || !errors.As(files[1].Err, &ue) || ue.StatusCode() != 413 {
+		t.Errorf("Uploads.SaveTo() big file error = %v, want ErrFileTooLarge", files[1].Err)
+	}
+	if !errors.Is(files[2].Err, ErrFileType) {
+		t.Errorf("Uploads.SaveTo() text file error = %v, want ErrFileType", files[2].Err)
+	}
+	if files[3].StoredName != "a_b-1.png" {
+		t.Errorf("Uploads.SaveTo() duplicate stored as %v, want a_b-1.png", files[3].StoredName)
+	}
+	if storage.Len() != 2 {
+		t.Errorf("MemoryStorage.Len() = %v, want 2", storage.Len())
+	}
+}
+
+func TestRequest_Uploads_limits(t *testing.T) {
+	parts := []uploadPart{
+		{field: "a", filename: "a.txt", content: bytes.Repeat([]byte("a"), 600)},
+		{field: "b", filename: "b.txt", content: bytes.Repeat([]byte("b"), 600)},
+	}
+
+	uploads, _ := newUploadRequest(t, parts).Uploads(UploadOptions{MaxFiles: 1})
+	files, err := uploads.SaveTo(NewMemoryStorage())
+	if !errors.Is(err, ErrTooManyFiles) || len(files) != 2 || files[0].Err != nil {
+		t.Errorf("Uploads.SaveTo() = %+v, %v, want ErrTooManyFiles for the second file", files, err)
+	}
+
+	uploads, _ = newUploadRequest(t, parts).Uploads(UploadOptions{MaxFiles: 1})
+	uploads.Next()
+	part, err := uploads.Next()
+	if n, rerr := part.Read(make([]byte, 8)); n != 0 || rerr != err || !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("UploadPart.Read() of a rejected part = %v, %v, want %v", n, rerr, err)
+	}
+
+	fields := []uploadPart{
+		{field: "note", content: bytes.Repeat([]byte("n"), 100)},
+		{field: "a", filename: "a.txt", content: []byte("a")},
+	}
+	uploads, _ = newUploadRequest(t, fields).Uploads(UploadOptions{MaxFieldSize: 99})
+	if part, err := uploads.Next(); part != nil || !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("Uploads.Next() = %v, %v, want ErrFieldTooLarge", part, err)
+	}
+	fields[0].content = bytes.Repeat([]byte("n"), defaultMaxFieldSize+1)
+	uploads, _ = newUploadRequest(t, fields).Uploads(UploadOptions{})
+	if _, err := uploads.Next(); !errors.Is(err, ErrFieldTooLarge) {
+		t.Errorf("Uploads.Next() error = %v, want the default field limit", err)
+	}
+	uploads, _ = newUploadRequest(t, fields).Uploads(UploadOptions{MaxFieldSize: -1})
+	if part, err := uploads.Next(); err != nil || part.Field != "a" || len(uploads.Values.Get("note")) != defaultMaxFieldSize+1 {
+		t.Errorf("Uploads.Next() = %v, %v, want no field limit", part, err)
+	}
+
+	uploads, _ = newUploadRequest(t, parts).Uploads(UploadOptions{MaxTotalSize: 800})
+	_, err = uploads.SaveTo(NewMemoryStorage())
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Errorf("Uploads.SaveTo() error = %v, want ErrUploadTooLarge", err)
+	}
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("a=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := newRequest(req, nil, false, nil).Uploads(UploadOptions{}); err == nil {
+		t.Errorf("Request.Uploads() error = nil for a non multipart body")
+	}
+}
+
+func TestDirStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewDirStorage(dir)
+	for _, want := range []string{"report.pdf", "report-1.pdf"} {
+		got, err := storage.Save("report.pdf", strings.NewReader("content"))
+		if err != nil || got != want {
+			t.Fatalf("dirStorage.Save() = %v, %v, want %v", got, err, want)
+		}
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "report-1.pdf"))
+	if string(data) != "content" {
+		t.Errorf("dirStorage.Save() wrote %q", data)
+	}
+
+	_, err := storage.Save("broken.bin", &partReader{
+		r:      strings.NewReader(strings.Repeat("x", 100)),
+		limit:  10,
+		body:   &countingReader{},
+		upload: &UploadError{},
+	})
+	if err == nil {
+		t.Errorf("dirStorage.Save() error = nil, want limit error")
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("dirStorage.Save() left %d files, want 2", len(entries))
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "../../etc/passwd", want: "passwd"},
+		{name: `C:\Users\agus\photo.jpg`, want: "photo.jpg"},
+		{name: ".htaccess", want: "htaccess"},
+		{name: "re:port<1>.pdf", want: "re_port_1_.pdf"},
+		{name: "foto ulang tahun.jpg", want: "foto_ulang_tahun.jpg"},
+		{name: "..", want: "file"},
+		{name: strings.Repeat("é", 200) + ".txt", want: strings.Repeat("é", 125) + ".txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeFilename(tt.name); got != tt.want {
+				t.Errorf("SanitizeFilename() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package fastrex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const validateTag = "validate"
+
+// ValidatorFunc reports whether value satisfies the rule. Param is the text after
+// the "=" in the tag, for example "3" in `validate:"min=3"`.
+type ValidatorFunc func(value interface{}, param string) bool
+
+// FieldError describes a single field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors is returned by Validate when one or more fields are invalid.
+// SendError renders it as a 422 response.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msg := make([]string, 0, len(e))
+	for _, f := range e {
+		msg = append(msg, f.Error())
+	}
+	return "validation failed: " + strings.Join(msg, "; ")
+}
+
+// StatusCode ...
+func (e ValidationErrors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// MarshalJSON ...
+func (e ValidationErrors) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Message string       `json:"message"`
+		Errors  []FieldError `json:"errors"`
+	}{"validation failed", e})
+}
+
+var (
+	validatorMu sync.RWMutex
+	validators  = map[string]ValidatorFunc{}
+	// checkedTypes holds the types passed to Validate whose rule names are all known.
+	// Rules are never unregistered, so a type stays valid once checked.
+	checkedTypes sync.Map
+)
+
+// RegisterValidator adds a custom rule usable in `validate` tags.
+// Registering an existing name replaces it, including the built-in min, max, len,
+// email and oneof rules. It panics for "required", which can not be replaced.
+func RegisterValidator(name string, fn ValidatorFunc) {
+	if name == "required" {
+		panic("fastrex: the required rule can not be replaced")
+	}
+	validatorMu.Lock()
+	defer validatorMu.Unlock()
+	validators[name] = fn
+}
+
+func customValidator(name string) (ValidatorFunc, bool) {
+	validatorMu.RLock()
+	defer validatorMu.RUnlock()
+	fn, ok := validators[name]
+	return fn, ok
+}
+
+// Validate checks v, a struct or a pointer to a struct, against its `validate` tags.
+//
+// Supported rules are required, min, max, len, email and oneof; rules are separated
+// by commas, for example `validate:"required,min=3,max=64"`. Nested structs and
+// slices of structs are validated recursively. Fields that are empty and not
+// required skip the remaining rules. Field names in the result follow the json tag.
+// A rule that is neither built in nor registered fails every call with a plain error,
+// whatever the field values, rather than a ValidationErrors.
+func Validate(v interface{}) error {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return errors.New("validate error: nil value")
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return errors.New("validate error: expected a struct, got " + val.Kind().String())
+	}
+	if _, ok := checkedTypes.Load(val.Type()); !ok {
+		if err := checkRules(val.Type(), map[reflect.Type]bool{}); err != nil {
+			return err
+		}
+		checkedTypes.Store(val.Type(), true)
+	}
+	errs := ValidationErrors{}
+	validateStruct(val, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(val reflect.Value, prefix string, errs *ValidationErrors) {
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := prefix + fieldName(sf)
+		field := val.Field(i)
+		tag := sf.Tag.Get(validateTag)
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			validateField(field, name, tag, errs)
+		}
+		validateNested(field, name, errs)
+	}
+}
+
+// checkRules reports the first unknown rule in the tags of t or of the structs it
+// contains. It walks the type rather than the value so the result does not depend
+// on which fields are set.
+func checkRules(t reflect.Type, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get(validateTag)
+		if tag == "-" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			rule = strings.TrimSpace(rule)
+			if i := strings.Index(rule, "="); i >= 0 {
+				rule = rule[:i]
+			}
+			if !knownRule(rule) {
+				return errors.New("validate error: unknown rule " + strconv.Quote(rule) + " on field " + t.String() + "." + sf.Name)
+			}
+		}
+		if err := checkRules(sf.Type, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func knownRule(rule string) bool {
+	switch rule {
+	case "", "required", "min", "max", "len", "email", "oneof":
+		return true
+	}
+	_, ok := customValidator(rule)
+	return ok
+}
+
+func validateNested(field reflect.Value, name string, errs *ValidationErrors) {
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		if field.IsNil() {
+			return
+		}
+		field = field.Elem()
+	}
+	switch field.Kind() {
+	case reflect.Struct:
+		validateStruct(field, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			validateNested(field.Index(i), name+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case reflect.Map:
+		iter := field.MapRange()
+		for iter.Next() {
+			validateNested(iter.Value(), fmt.Sprintf("%v[%v]", name, iter.Key().Interface()), errs)
+		}
+	}
+}
+
+func fieldName(sf reflect.StructField) string {
+	tag := sf.Tag.Get("json")
+	if tag == "" || tag == "-" {
+		return sf.Name
+	}
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "" {
+		return sf.Name
+	}
+	return tag
+}
+
+func validateField(field reflect.Value, name string, tag string, errs *ValidationErrors) {
+	rules := strings.Split(tag, ",")
+	if isEmptyValue(field) {
+		for _, rule := range rules {
+			if strings.TrimSpace(rule) == "required" {
+				*errs = append(*errs, FieldError{Field: name, Rule: "required", Message: "is required"})
+			}
+		}
+		return
+	}
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || rule == "required" {
+			continue
+		}
+		param := ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			rule, param = rule[:i], rule[i+1:]
+		}
+		if fn, ok := customValidator(rule); ok {
+			if !fn(field.Interface(), param) {
+				*errs = append(*errs, FieldError{Field: name, Rule: rule, Param: param, Message: "failed " + rule + " validation"})
+			}
+			continue
+		}
+		if msg := checkRule(field, rule, param); msg != "" {
+			*errs = append(*errs, FieldError{Field: name, Rule: rule, Param: param, Message: msg})
+		}
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.IsNil() || v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func checkRule(field reflect.Value, rule string, param string) string {
+	for field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface {
+		field = field.Elem()
+	}
+	switch rule {
+	case "min", "max", "len":
+		return checkSize(field, rule, param)
+	case "email":
+		if field.Kind() != reflect.String {
+			return "must be a string"
+		}
+		addr, err := mail.ParseAddress(field.String())
+		if err != nil || addr.Address != field.String() {
+			return "must be a valid email address"
+		}
+	case "oneof":
+		value := fmt.Sprint(field.Interface())
+		for _, option := range strings.Fields(param) {
+			if value == option {
+				return ""
+			}
+		}
+		return "must be one of [" + param + "]"
+	}
+	return ""
+}
+
+func checkSize(field reflect.Value, rule string, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "invalid " + rule + " parameter " + strconv.Quote(param)
+	}
+
+	var (
+		size   float64
+		suffix string
+	)
+	switch field.Kind() {
+	case reflect.String:
+		size = float64(utf8.RuneCountInString(field.String()))
+		suffix = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size = float64(field.Len())
+		suffix = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		size = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = field.Float()
+	default:
+		return "unsupported type for " + rule
+	}
+
+	switch {
+	case rule == "min" && size < limit:
+		if suffix == "" {
+			return "must be at least " + param
+		}
+		return "must have at least " + param + suffix
+	case rule == "max" && size > limit:
+		if suffix == "" {
+			return "must be at most " + param
+		}
+		return "must have at most " + param + suffix
+	case rule == "len" && size != limit:
+		if suffix == "" {
+			return "must equal " + param
+		}
+		return "must have exactly " + param + suffix
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package fastrex
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"len=5"`
+}
+
+type validateItem struct {
+	Name string `json:"name" validate:"required,max=4"`
+}
+
+type validateUser struct {
+	Name    string           `json:"name" validate:"required,min=3,max=8"`
+	Email   string           `json:"email" validate:"required,email"`
+	Role    string           `json:"role" validate:"oneof=admin user"`
+	Age     int              `json:"age" validate:"min=18,max=130"`
+	Tags    []string         `json:"tags" validate:"max=2"`
+	Address validateAddress  `json:"address"`
+	Items   []validateItem   `json:"items"`
+	Billing *validateAddress `json:"billing,omitempty"`
+	Code    string           `validate:"even"`
+	skipped string           `validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidator("even", func(value interface{}, param string) bool {
+		s, ok := value.(string)
+		return ok && len(s)%2 == 0
+	})
+
+	tests := []struct {
+		name    string
+		input   interface{}
+		want    ValidationErrors
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			input: &validateUser{
+				Name:    "agus",
+				Email:   "agus@example.com",
+				Role:    "admin",
+				Age:     30,
+				Address: validateAddress{City: "Jakarta"},
+				Items:   []validateItem{{Name: "a"}},
+				Code:    "ab",
+			},
+		},
+		{
+			name: "invalid",
+			input: validateUser{
+				Name:    "ag",
+				Email:   "not-an-email",
+				Role:    "root",
+				Age:     12,
+				Tags:    []string{"a", "b", "c"},
+				Address: validateAddress{Zip: "123"},
+				Items:   []validateItem{{Name: "ok"}, {Name: "too long"}},
+				Billing: &validateAddress{City: "Bandung", Zip: "12345"},
+				Code:    "abc",
+			},
+			want: ValidationErrors{
+				{Field: "name", Rule: "min", Param: "3", Message: "must have at least 3 characters"},
+				{Field: "email", Rule: "email", Message: "must be a valid email address"},
+				{Field: "role", Rule: "oneof", Param: "admin user", Message: "must be one of [admin user]"},
+				{Field: "age", Rule: "min", Param: "18", Message: "must be at least 18"},
+				{Field: "tags", Rule: "max", Param: "2", Message: "must have at most 2 items"},
+				{Field: "address.city", Rule: "required", Message: "is required"},
+				{Field: "address.zip", Rule: "len", Param: "5", Message: "must have exactly 5 characters"},
+				{Field: "items[1].name", Rule: "max", Param: "4", Message: "must have at most 4 characters"},
+				{Field: "Code", Rule: "even", Message: "failed even validation"},
+			},
+		},
+		{
+			name:    "not a struct",
+			input:   "agus",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Validate() error = nil, want error")
+				}
+				return
+			}
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if got, _ := err.(ValidationErrors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_unknownRule(t *testing.T) {
+	type item struct {
+		Code string `validate:"requird"`
+	}
+	type input struct {
+		Name  string `validate:"requird"`
+		Items []item
+	}
+	type nested struct {
+		Items []item
+	}
+	tests := []struct {
+		name    string
+		v       interface{}
+		wantErr string
+	}{
+		{"set", input{Name: "agus"}, `validate error: unknown rule "requird" on field fastrex.input.Name`},
+		{"empty", input{}, `validate error: unknown rule "requird" on field fastrex.input.Name`},
+		{"nested empty", nested{}, `validate error: unknown rule "requird" on field fastrex.item.Code`},
+		{"nested set", &nested{Items: []item{{Code: "a"}}}, `validate error: unknown rule "requird" on field fastrex.item.Code`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.v)
+			if _, ok := err.(ValidationErrors); ok || err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Validate() error = %#v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegisterValidator_required(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("RegisterValidator(\"required\") did not panic")
+		}
+	}()
+	RegisterValidator("required", func(interface{}, string) bool { return true })
+}
+
+func Test_httpResponse_SendError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "validation errors",
+			err:        ValidationErrors{{Field: "name", Rule: "required", Message: "is required"}},
+			wantStatus: 422,
+			wantBody:   `{"message":"validation failed","errors":[{"field":"name","rule":"required","message":"is required"}]}`,
+		},
+		{
+			name:       "wrapped validation errors",
+			err:        fmt.Errorf("create user: %w", ValidationErrors{{Field: "name", Rule: "required", Message: "is required"}}),
+			wantStatus: 422,
+			wantBody:   `{"message":"validation failed","errors":[{"field":"name","rule":"required","message":"is required"}]}`,
+		},
+		{
+			name:       "plain error",
+			err:        errors.New("database is down"),
+			wantStatus: 500,
+			wantBody:   `{"message":"Internal Server Error"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			w := httptest.NewRecorder()
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				r2.SendError(tt.err)
+			}
+			handler.ServeHTTP(w, req, nil, nil, nil, map[string]interface{}{})
+
+			resp := w.Result()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Response.SendError() status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if got := string(body); got != tt.wantBody {
+				t.Errorf("Response.SendError() = %v, want %v", got, tt.wantBody)
+			}
+		})
+	}
+}
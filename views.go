@@ -0,0 +1,229 @@
+package fastrex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultViewExt     = ".html"
+	defaultLayoutsDir  = "layouts"
+	defaultPartialsDir = "partials"
+	viewContent        = "content"
+)
+
+// ViewOptions configures App.Views.
+//
+// Views are named by their path relative to Dir without the extension, such as
+// "users/show". Files in PartialsDir can be included from any view or layout by
+// name, for example {{template "partials/nav" .}}. Files in LayoutsDir wrap a view:
+// the layout includes it with {{template "content" .}}, and blocks the layout
+// declares with {{block "title" .}} can be filled by {{define "title"}} in the view.
+type ViewOptions struct {
+	Dir string
+	// Patterns are globs, matched against slash separated paths relative to Dir, of
+	// the files to load, layouts and partials included. Defaults to every .html file.
+	Patterns []string
+	// Layout is the layout Render(view, data) uses. Empty renders views alone.
+	Layout      string
+	LayoutsDir  string
+	PartialsDir string
+}
+
+// views holds the parsed partials and the sources of views and layouts. A view is
+// parsed with its layout on first use and cached.
+type views struct {
+	opts    ViewOptions
+	base    *template.Template
+	pages   map[string]string
+	layouts map[string]string
+	mu      sync.Mutex
+	cache   map[string]*template.Template
+}
+
+func loadViews(opts ViewOptions, funcs template.FuncMap) (*views, error) {
+	if opts.LayoutsDir == "" {
+		opts.LayoutsDir = defaultLayoutsDir
+	}
+	if opts.PartialsDir == "" {
+		opts.PartialsDir = defaultPartialsDir
+	}
+	v := &views{
+		opts:    opts,
+		base:    template.New("").Funcs(funcs),
+		pages:   map[string]string{},
+		layouts: map[string]string{},
+		cache:   map[string]*template.Template{},
+	}
+	err := filepath.Walk(opts.Dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(opts.Dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !v.matches(rel) {
+			return nil
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(rel, path.Ext(rel))
+		switch {
+		case strings.HasPrefix(rel, opts.PartialsDir+"/"):
+			_, err = v.base.New(name).Parse(string(data))
+		case strings.HasPrefix(rel, opts.LayoutsDir+"/"):
+			v.layouts[strings.TrimPrefix(name, opts.LayoutsDir+"/")] = string(data)
+		default:
+			v.pages[name] = string(data)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse everything once so syntax errors surface at startup.
+	for name := range v.pages {
+		if _, err := v.lookup(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	for name, src := range v.layouts {
+		t := template.Must(v.base.Clone())
+		if _, err := t.New(opts.LayoutsDir + "/" + name).Parse(src); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (v *views) matches(rel string) bool {
+	if len(v.opts.Patterns) == 0 {
+		return path.Ext(rel) == defaultViewExt
+	}
+	for _, p := range v.opts.Patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *views) has(name string) bool {
+	_, ok := v.pages[name]
+	return ok
+}
+
+// lookup returns the template rendering view name inside layout.
+func (v *views) lookup(name, layout string) (*template.Template, error) {
+	layout = strings.TrimPrefix(layout, v.opts.LayoutsDir+"/")
+	key := name + "\x00" + layout
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if t, ok := v.cache[key]; ok {
+		return t, nil
+	}
+
+	page, ok := v.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("Render error: view %q not found", name)
+	}
+	t, err := v.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if layout == "" {
+		t, err = t.New(name).Parse(page)
+	} else {
+		src, ok := v.layouts[layout]
+		if !ok {
+			return nil, fmt.Errorf("Render error: layout %q not found", layout)
+		}
+		t, err = t.New(v.opts.LayoutsDir + "/" + layout).Parse(src)
+		if err == nil {
+			// Parsed after the layout so the view's definitions replace its blocks.
+			_, err = t.New(viewContent).Parse(page)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.cache[key] = t
+	return t, nil
+}
+
+// views returns the views of the module serving the request, or the app views.
+func (h *httpResponse) views() *views {
+	s := h.settings()
+	if s == nil {
+		return nil
+	}
+	found, longest := s.views, -1
+	for prefix, v := range s.moduleViews {
+		if strings.HasPrefix(h.r.URL.Path, prefix) && len(prefix) > longest {
+			found, longest = v, len(prefix)
+		}
+	}
+	return found
+}
+
+// renderView executes view inside layout and sends the result. Nothing is written
+// when execution fails.
+func (h *httpResponse) renderView(v *views, name, layout string, data interface{}) error {
+	t, err := v.lookup(name, layout)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, h.withLocals(data)); err != nil {
+		return err
+	}
+	h.writer().Header().Set(HeaderContentType, MimeTextHtml)
+	if h.s != http.StatusOK {
+		h.writer().WriteHeader(h.s)
+	}
+	_, err = h.writer().Write(buf.Bytes())
+	return err
+}
+
+// viewArgs recognises the Render(view, data) and Render(view, data, layout) forms
+// served by v.
+func viewArgs(v *views, args []interface{}) (name, layout string, ok bool, err error) {
+	if v == nil || len(args) < 2 || len(args) > 3 {
+		return "", "", false, nil
+	}
+	name, ok = args[0].(string)
+	if !ok || (len(args) == 2 && !v.has(name)) {
+		return "", "", false, nil
+	}
+	layout = v.opts.Layout
+	if len(args) == 3 {
+		if layout, ok = args[2].(string); !ok {
+			return "", "", false, errors.New("Render error: layout must be a string")
+		}
+	}
+	return name, layout, true, nil
+}
+
+func mergeFuncs(maps ...template.FuncMap) template.FuncMap {
+	funcs := template.FuncMap{}
+	for _, m := range maps {
+		for k, f := range m {
+			funcs[k] = f
+		}
+	}
+	return funcs
+}
@@ -0,0 +1,224 @@
+package fastrex
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeViews(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "views")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var testFuncs = template.FuncMap{"upper": strings.ToUpper}
+
+func TestApp_Views(t *testing.T) {
+	dir := writeViews(t, map[string]string{
+		"index.html":         `{{define "title"}}Home{{end}}<p>{{upper .name}}</p>{{template "partials/nav" .}}`,
+		"users/show.html":    `<p>{{.name}}</p>`,
+		"layouts/main.html":  `<title>{{block "title" .}}Default{{end}}</title><main>{{template "content" .}}</main>`,
+		"layouts/plain.html": `[{{template "content" .}}]`,
+		"partials/nav.html":  `<nav>{{.site}}</nav>`,
+		"notes.txt":          `{{not a template`,
+	})
+	tests := []struct {
+		name       string
+		render     func(res Response) error
+		wantStatus int
+		wantBody   string
+		wantErr    string
+	}{
+		{
+			name:       "default layout",
+			render:     func(res Response) error { return res.Render("index", map[string]interface{}{"name": "agus"}) },
+			wantStatus: 200,
+			wantBody:   "<title>Home</title><main><p>AGUS</p><nav>fastrex</nav></main>",
+		},
+		{
+			name:       "default block",
+			render:     func(res Response) error { return res.Render("users/show", map[string]interface{}{"name": "x"}) },
+			wantStatus: 200,
+			wantBody:   "<title>Default</title><main><p>x</p></main>",
+		},
+		{
+			name: "explicit layout",
+			render: func(res Response) error {
+				return res.Status(201).Render("users/show", map[string]interface{}{"name": "x"}, "plain")
+			},
+			wantStatus: 201,
+			wantBody:   "[<p>x</p>]",
+		},
+		{
+			name:       "no layout",
+			render:     func(res Response) error { return res.Render("users/show", map[string]interface{}{"name": "<b>"}, "") },
+			wantStatus: 200,
+			wantBody:   "<p>&lt;b&gt;</p>",
+		},
+		{
+			name:       "missing view",
+			render:     func(res Response) error { return res.Render("missing", nil, "main") },
+			wantStatus: 200,
+			wantErr:    `Render error: view "missing" not found`,
+		},
+		{
+			name:       "missing layout",
+			render:     func(res Response) error { return res.Render("index", nil, "missing") },
+			wantStatus: 200,
+			wantErr:    `Render error: layout "missing" not found`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			// Funcs registered after Views are still known when the views are parsed.
+			app := New().Views(ViewOptions{Dir: dir, Layout: "main"}).Funcs(testFuncs)
+			app.Get("/", func(req Request, res Response) {
+				req.Set("site", "fastrex")
+				err = tt.render(res)
+			})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			if (err != nil || tt.wantErr != "") && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Response.Render() error = %v, want %v", err, tt.wantErr)
+			}
+			if w.Code != tt.wantStatus || w.Body.String() != tt.wantBody {
+				t.Errorf("Response.Render() = %v %q, want %v %q", w.Code, w.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestApp_Views_modules(t *testing.T) {
+	appDir := writeViews(t, map[string]string{"home.html": `app {{upper "home"}}`})
+	adminDir := writeViews(t, map[string]string{
+		"home.tmpl":         `admin {{upper "home"}} {{stars 3}}`,
+		"layouts/base.tmpl": `[{{template "content" .}}]`,
+		"draft.html":        `{{broken`,
+	})
+	legacy := writeViews(t, map[string]string{"legacy.html": `{{upper "legacy"}}`})
+
+	app := New().Funcs(testFuncs).Views(ViewOptions{Dir: appDir})
+	app.Get("/", func(req Request, res Response) {
+		res.Render("home", nil)
+	})
+	app.Register(func(module App) App {
+		module.Funcs(template.FuncMap{"stars": func(n int) string { return strings.Repeat("*", n) }})
+		module.Views(ViewOptions{Dir: adminDir, Patterns: []string{"*.tmpl", "layouts/*.tmpl"}, Layout: "base"})
+		module.Template(filepath.Join(legacy, "legacy.html"))
+		module.Get("/", func(req Request, res Response) {
+			res.Render("home", nil)
+		})
+		module.Get("/legacy", func(req Request, res Response) {
+			res.Render()
+		})
+		return module
+	}, "/admin")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/", want: "app HOME"},
+		{path: "/admin", want: "[admin HOME ***]"},
+		{path: "/admin/legacy", want: "LEGACY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Body.String() != tt.want {
+				t.Errorf("Response.Render() = %q, want %q", w.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_Views_loadError(t *testing.T) {
+	broken := writeViews(t, map[string]string{"index.html": `{{if}}`})
+	tests := []struct {
+		name  string
+		setup func(app App)
+	}{
+		{
+			name:  "app views",
+			setup: func(app App) { app.Views(ViewOptions{Dir: broken}) },
+		},
+		{
+			name: "module views",
+			setup: func(app App) {
+				app.Register(func(module App) App {
+					return module.Views(ViewOptions{Dir: broken})
+				}, "/admin")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			app := New().Log(log.New(&logs, "", 0))
+			tt.setup(app)
+			app.Get("/", func(req Request, res Response) {
+				res.Send("ok")
+			})
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+				if w.Code != 500 {
+					t.Errorf("App.ServeHTTP() status = %v, want 500", w.Code)
+				}
+			}
+			if n := strings.Count(logs.String(), "missing value for if"); n != 1 {
+				t.Errorf("load error logged %v times, want once: %q", n, logs.String())
+			}
+
+			listen := New()
+			tt.setup(listen)
+			if err := listen.Listen(0); err == nil {
+				t.Errorf("App.Listen() error = nil, want the views error")
+			}
+		})
+	}
+}
+
+func Test_loadViews_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{name: "view syntax", files: map[string]string{"index.html": `{{if}}`}},
+		{name: "layout syntax", files: map[string]string{"layouts/main.html": `{{end}}`}},
+		{name: "unknown function", files: map[string]string{"partials/nav.html": `{{shout .}}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadViews(ViewOptions{Dir: writeViews(t, tt.files)}, testFuncs); err == nil {
+				t.Errorf("loadViews() error = nil, want a parse error")
+			}
+		})
+	}
+	if _, err := loadViews(ViewOptions{Dir: "does-not-exist"}, nil); err == nil {
+		t.Errorf("loadViews() error = nil for a missing directory")
+	}
+}
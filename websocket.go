@@ -0,0 +1,444 @@
+package fastrex
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	wsGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	defaultWSReadLimit = 1 << 20
+	maxControlPayload  = 125
+	// wsReadChunk caps the memory allocated for a frame before its payload arrives.
+	wsReadChunk = 64 << 10
+)
+
+// WSMessageType is the type of a WebSocket data message.
+type WSMessageType int
+
+const (
+	// TextMessage holds UTF-8 text.
+	TextMessage WSMessageType = 1
+	// BinaryMessage holds arbitrary bytes.
+	BinaryMessage WSMessageType = 2
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Close codes defined by RFC 6455 section 7.4.1.
+const (
+	CloseNormalClosure       = 1000
+	CloseGoingAway           = 1001
+	CloseProtocolError       = 1002
+	CloseUnsupportedData     = 1003
+	CloseNoStatusReceived    = 1005
+	CloseAbnormalClosure     = 1006
+	CloseInvalidPayload      = 1007
+	ClosePolicyViolation     = 1008
+	CloseMessageTooBig       = 1009
+	CloseInternalServerError = 1011
+)
+
+// ErrWSClosed is returned when writing to a connection after Close.
+var ErrWSClosed = errors.New("websocket: connection closed")
+
+// WSCloseError is returned by ReadMessage when the connection was closed with a
+// close frame, by the peer or because the peer broke the protocol.
+type WSCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *WSCloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// WSHandler handles an upgraded WebSocket connection. The connection is closed when
+// the handler returns.
+type WSHandler func(Request, *WSConn)
+
+// WSConn is a server side WebSocket connection. One goroutine may read while others
+// write.
+type WSConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	wmu       sync.Mutex
+	readLimit int64
+	closeSent bool
+	closed    bool
+}
+
+func (r *app) WS(path string, handler WSHandler, middleware ...Middleware) App {
+	return r.Get(path, func(req Request, res Response) {
+		conn, err := upgradeWS(req, res)
+		if err != nil {
+			return
+		}
+		defer conn.Close(CloseNormalClosure, "")
+		handler(req, conn)
+	}, middleware...)
+}
+
+func (r *app) CheckOrigin(check func(Request) bool) App {
+	r.settings.checkOrigin = check
+	return r
+}
+
+// sameOrigin is the default CheckOrigin.
+func sameOrigin(req Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, req.Host)
+}
+
+// upgradeWS performs the opening handshake. Failures are answered with an error
+// response and returned. Cookies queued before the upgrade are sent with the 101.
+func upgradeWS(req Request, res Response) (*WSConn, error) {
+	fail := func(code int, msg string) error {
+		err := &statusError{code: code, err: errors.New("websocket: " + msg)}
+		res.SendError(err)
+		return err
+	}
+	if req.Method != http.MethodGet {
+		return nil, fail(http.StatusMethodNotAllowed, "method must be GET")
+	}
+	if !headerHasToken(req.Header, "Connection", "upgrade") || !headerHasToken(req.Header, "Upgrade", "websocket") {
+		return nil, fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		res.Set("Sec-WebSocket-Version", "13")
+		return nil, fail(http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return nil, fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := sameOrigin
+	if req.state != nil && req.state.settings != nil && req.state.settings.checkOrigin != nil {
+		checkOrigin = req.state.settings.checkOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, fail(http.StatusForbidden, "origin not allowed")
+	}
+
+	conn, brw, err := res.Hijack()
+	if err != nil {
+		return nil, fail(http.StatusInternalServerError, err.Error())
+	}
+	conn.SetDeadline(time.Time{})
+	handshake := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n"
+	if req.state != nil {
+		header := http.Header{}
+		req.state.writeCookies(header)
+		for _, c := range header["Set-Cookie"] {
+			handshake += "Set-Cookie: " + c + "\r\n"
+		}
+	}
+	handshake += "\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WSConn{conn: conn, br: brw.Reader, readLimit: defaultWSReadLimit}, nil
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts. Larger messages close
+// the connection with CloseMessageTooBig. Defaults to 1MB; zero or a negative limit
+// accepts messages of any size.
+func (c *WSConn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetReadDeadline ...
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline ...
+func (c *WSConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// RemoteAddr ...
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next data message, reassembling fragments. Pings are
+// answered while reading. A close frame ends the connection and is returned as
+// *WSCloseError.
+func (c *WSConn) ReadMessage() (WSMessageType, []byte, error) {
+	var (
+		msgType WSMessageType
+		msg     []byte
+		started bool
+	)
+	for {
+		fin, op, payload, err := c.readFrame(started, int64(len(msg)))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+		case opText, opBinary:
+			msgType = WSMessageType(op)
+			started = true
+		}
+		msg = append(msg, payload...)
+		if fin {
+			if msgType == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8 in text message")
+			}
+			return msgType, msg, nil
+		}
+	}
+}
+
+// readFrame reads one frame and unmasks its payload. started tells whether a
+// fragmented message is in progress and size how many bytes it holds so far.
+func (c *WSConn) readFrame(started bool, size int64) (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	fin := head[0]&0x80 != 0
+	op := head[0] & 0x0f
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frames must be masked")
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		if ext[0]&0x80 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid frame length")
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	switch op {
+	case opClose, opPing, opPong:
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+		}
+	case opText, opBinary:
+		if started {
+			return false, 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+		}
+	case opContinuation:
+		if !started {
+			return false, 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+		}
+	default:
+		return false, 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+	}
+	if op < opClose && c.readLimit > 0 && size+length > c.readLimit {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	// The length comes from the client, so memory grows with the bytes actually
+	// read rather than being allocated up front.
+	capacity := length
+	if capacity > wsReadChunk {
+		capacity = wsReadChunk
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, capacity))
+	if _, err := io.CopyN(buf, c.br, length); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	payload := buf.Bytes()
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose answers a close frame from the peer and closes the connection.
+func (c *WSConn) handleClose(payload []byte) error {
+	code := CloseNoStatusReceived
+	text := ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidPayload, "invalid UTF-8 in close reason")
+		}
+	}
+	reply := code
+	if reply == CloseNoStatusReceived {
+		reply = CloseNormalClosure
+	}
+	c.Close(reply, "")
+	return &WSCloseError{Code: code, Text: text}
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	}
+	return false
+}
+
+// fail closes the connection because the peer broke the protocol.
+func (c *WSConn) fail(code int, text string) error {
+	c.Close(code, text)
+	return &WSCloseError{Code: code, Text: text}
+}
+
+func (c *WSConn) readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.closeConn()
+		return &WSCloseError{Code: CloseAbnormalClosure, Text: "unexpected EOF"}
+	}
+	return err
+}
+
+// WriteMessage sends data as a single frame.
+func (c *WSConn) WriteMessage(t WSMessageType, data []byte) error {
+	if t != TextMessage && t != BinaryMessage {
+		return errors.New("websocket: invalid message type")
+	}
+	return c.writeFrame(byte(t), data)
+}
+
+// Ping sends a ping. The peer answers with a pong, which ReadMessage skips.
+func (c *WSConn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("websocket: control frame payload too long")
+	}
+	return c.writeFrame(opPing, data)
+}
+
+func (c *WSConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrWSClosed
+	}
+	return c.writeFrameLocked(op, payload)
+}
+
+func (c *WSConn) writeFrameLocked(op byte, payload []byte) error {
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|op)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, ext[:]...)
+	}
+	frame = append(frame, payload...)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame with code and reason, once, and closes the connection.
+func (c *WSConn) Close(code int, reason string) error {
+	c.wmu.Lock()
+	var err error
+	if !c.closeSent {
+		c.closeSent = true
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > maxControlPayload {
+			payload = payload[:maxControlPayload]
+		}
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		err = c.writeFrameLocked(opClose, payload)
+	}
+	c.wmu.Unlock()
+	c.closeConn()
+	return err
+}
+
+func (c *WSConn) closeConn() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.closeSent = true
+		c.conn.Close()
+	}
+}
@@ -0,0 +1,389 @@
+package fastrex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient is a minimal client that writes raw frames, so tests can break the protocol.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWS(t *testing.T, url string, header http.Header) (*wsClient, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest("GET", url+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Write(conn)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsClient{conn: conn, br: br}, resp
+}
+
+func (c *wsClient) writeFrame(fin bool, op byte, payload []byte, masked bool) {
+	head := []byte{op}
+	if fin {
+		head[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		head = append(head, maskBit|byte(n))
+	case n <= 0xffff:
+		head = append(head, maskBit|126, byte(n>>8), byte(n))
+	default:
+		head = append(head, maskBit|127)
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		head = append(head, ext[:]...)
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		head = append(head, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	c.conn.Write(append(head, data...))
+}
+
+func (c *wsClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.br, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(c.br, payload)
+	return head[0] & 0x0f, payload
+}
+
+func closeCode(payload []byte) int {
+	if len(payload) < 2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func newWSServer(handler WSHandler, middleware ...Middleware) *httptest.Server {
+	app := New()
+	app.WS("/ws", handler, middleware...)
+	return httptest.NewServer(app)
+}
+
+func echoWS(req Request, conn *WSConn) {
+	for {
+		t, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(t, msg)
+	}
+}
+
+func TestApp_WS_echo(t *testing.T) {
+	srv := newWSServer(echoWS)
+	defer srv.Close()
+
+	c, resp := dialWS(t, srv.URL, nil)
+	defer c.conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %v, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %v", got)
+	}
+
+	c.writeFrame(true, opText, []byte("hello"), true)
+	if op, payload := c.readFrame(t); op != opText || string(payload) != "hello" {
+		t.Errorf("echo = %v %q, want text hello", op, payload)
+	}
+
+	big := []byte(strings.Repeat("x", 70000))
+	c.writeFrame(true, opBinary, big, true)
+	if op, payload := c.readFrame(t); op != opBinary || len(payload) != len(big) {
+		t.Errorf("echo = %v %d bytes, want binary %d bytes", op, len(payload), len(big))
+	}
+
+	// A ping between fragments is answered before the message completes.
+	c.writeFrame(false, opText, []byte("frag"), true)
+	c.writeFrame(true, opPing, []byte("p"), true)
+	c.writeFrame(false, opContinuation, []byte("men"), true)
+	c.writeFrame(true, opContinuation, []byte("ted"), true)
+	if op, payload := c.readFrame(t); op != opPong || string(payload) != "p" {
+		t.Errorf("ping reply = %v %q, want pong p", op, payload)
+	}
+	if op, payload := c.readFrame(t); op != opText || string(payload) != "fragmented" {
+		t.Errorf("echo = %v %q, want text fragmented", op, payload)
+	}
+
+	c.writeFrame(true, opClose, []byte{0x03, 0xe9}, true)
+	if op, payload := c.readFrame(t); op != opClose || closeCode(payload) != CloseGoingAway {
+		t.Errorf("close reply = %v %v, want close 1001", op, closeCode(payload))
+	}
+}
+
+func TestApp_WS_protocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int64
+		send     func(c *wsClient)
+		wantCode int
+	}{
+		{
+			name:     "unmasked frame",
+			send:     func(c *wsClient) { c.writeFrame(true, opText, []byte("hi"), false) },
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "unknown opcode",
+			send:     func(c *wsClient) { c.writeFrame(true, 0x3, nil, true) },
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "unexpected continuation",
+			send:     func(c *wsClient) { c.writeFrame(true, opContinuation, []byte("x"), true) },
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "fragmented ping",
+			send:     func(c *wsClient) { c.writeFrame(false, opPing, nil, true) },
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "invalid close code",
+			send:     func(c *wsClient) { c.writeFrame(true, opClose, []byte{0x03, 0xed}, true) },
+			wantCode: CloseProtocolError,
+		},
+		{
+			name:     "invalid utf-8",
+			send:     func(c *wsClient) { c.writeFrame(true, opText, []byte{0xff, 0xfe}, true) },
+			wantCode: CloseInvalidPayload,
+		},
+		{
+			name:  "message too big",
+			limit: 8,
+			send: func(c *wsClient) {
+				c.writeFrame(false, opBinary, []byte("12345"), true)
+				c.writeFrame(true, opContinuation, []byte("67890"), true)
+			},
+			wantCode: CloseMessageTooBig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			srv := newWSServer(func(req Request, conn *WSConn) {
+				if tt.limit > 0 {
+					conn.SetReadLimit(tt.limit)
+				}
+				_, _, err := conn.ReadMessage()
+				errs <- err
+			})
+			defer srv.Close()
+
+			c, _ := dialWS(t, srv.URL, nil)
+			defer c.conn.Close()
+			tt.send(c)
+			if op, payload := c.readFrame(t); op != opClose || closeCode(payload) != tt.wantCode {
+				t.Errorf("server sent %v %v, want close %v", op, closeCode(payload), tt.wantCode)
+			}
+			err, _ := (<-errs).(*WSCloseError)
+			if err == nil || err.Code != tt.wantCode {
+				t.Errorf("WSConn.ReadMessage() error = %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestApp_WS_unlimitedRead(t *testing.T) {
+	errs := make(chan error, 1)
+	srv := newWSServer(func(req Request, conn *WSConn) {
+		conn.SetReadLimit(0)
+		_, _, err := conn.ReadMessage()
+		errs <- err
+	})
+	defer srv.Close()
+
+	c, _ := dialWS(t, srv.URL, nil)
+	// A frame claiming 2^62 bytes that ends after three.
+	frame := []byte{0x82, 0x80 | 127}
+	frame = append(frame, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(frame[2:], 1<<62)
+	frame = append(frame, 0, 0, 0, 0, 'a', 'b', 'c')
+	c.conn.Write(frame)
+	c.conn.Close()
+
+	select {
+	case err := <-errs:
+		if err, _ := err.(*WSCloseError); err == nil || err.Code != CloseAbnormalClosure {
+			t.Errorf("WSConn.ReadMessage() error = %v, want abnormal closure", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WSConn.ReadMessage() did not return")
+	}
+}
+
+func TestApp_WS_handshake(t *testing.T) {
+	auth := func(req Request, res Response, next Next) {
+		if req.Header.Get("Authorization") == "" {
+			res.Status(http.StatusUnauthorized).Send("unauthorized")
+			return
+		}
+		c := Cookie{}
+		c.Name("sid").Value("1").HttpOnly(true)
+		res.Cookie(c)
+		next(req, res)
+	}
+	srv := newWSServer(echoWS, auth)
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		header      http.Header
+		wantStatus  int
+		wantVersion string
+		wantCookie  string
+	}{
+		{
+			name:       "upgraded",
+			header:     http.Header{"Authorization": {"token"}},
+			wantStatus: http.StatusSwitchingProtocols,
+			wantCookie: "sid=1; HttpOnly",
+		},
+		{
+			name:       "same origin",
+			header:     http.Header{"Authorization": {"token"}, "Origin": {srv.URL}},
+			wantStatus: http.StatusSwitchingProtocols,
+			wantCookie: "sid=1; HttpOnly",
+		},
+		{
+			name:       "cross origin",
+			header:     http.Header{"Authorization": {"token"}, "Origin": {"http://evil.example"}},
+			wantStatus: http.StatusForbidden,
+			wantCookie: "sid=1; HttpOnly",
+		},
+		{
+			name:       "rejected by middleware",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "unsupported version",
+			header:      http.Header{"Authorization": {"token"}, "Sec-Websocket-Version": {"8"}},
+			wantStatus:  http.StatusUpgradeRequired,
+			wantVersion: "13",
+			wantCookie:  "sid=1; HttpOnly",
+		},
+		{
+			name:       "invalid key",
+			header:     http.Header{"Authorization": {"token"}, "Sec-Websocket-Key": {"short"}},
+			wantStatus: http.StatusBadRequest,
+			wantCookie: "sid=1; HttpOnly",
+		},
+		{
+			name:       "not an upgrade",
+			header:     http.Header{"Authorization": {"token"}, "Upgrade": {"h2c"}},
+			wantStatus: http.StatusBadRequest,
+			wantCookie: "sid=1; HttpOnly",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, resp := dialWS(t, srv.URL, tt.header)
+			defer c.conn.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("handshake status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Version"); got != tt.wantVersion {
+				t.Errorf("Sec-WebSocket-Version = %q, want %q", got, tt.wantVersion)
+			}
+			if got := resp.Header.Get("Set-Cookie"); got != tt.wantCookie {
+				t.Errorf("Set-Cookie = %q, want %q", got, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestApp_CheckOrigin(t *testing.T) {
+	app := New().CheckOrigin(func(req Request) bool {
+		return req.Header.Get("Origin") == "https://app.example"
+	})
+	app.WS("/ws", echoWS)
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	tests := []struct {
+		origin     string
+		wantStatus int
+	}{
+		{origin: "https://app.example", wantStatus: http.StatusSwitchingProtocols},
+		{origin: srv.URL, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			c, resp := dialWS(t, srv.URL, http.Header{"Origin": {tt.origin}})
+			defer c.conn.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("handshake status = %v, want %v", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWSConn_Close(t *testing.T) {
+	srv := newWSServer(func(req Request, conn *WSConn) {
+		conn.WriteMessage(TextMessage, []byte("bye"))
+		conn.Close(ClosePolicyViolation, "policy")
+		if err := conn.WriteMessage(TextMessage, []byte("late")); err != ErrWSClosed {
+			t.Errorf("WSConn.WriteMessage() after Close = %v, want ErrWSClosed", err)
+		}
+	})
+	defer srv.Close()
+
+	c, _ := dialWS(t, srv.URL, nil)
+	defer c.conn.Close()
+	if op, payload := c.readFrame(t); op != opText || string(payload) != "bye" {
+		t.Errorf("message = %v %q", op, payload)
+	}
+	op, payload := c.readFrame(t)
+	if op != opClose || closeCode(payload) != ClosePolicyViolation || string(payload[2:]) != "policy" {
+		t.Errorf("close frame = %v %q", op, payload)
+	}
+}
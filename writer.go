@@ -0,0 +1,121 @@
+package fastrex
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseWriter is shared by every Response of one request. It writes the header
+// once and records what was sent.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+	// beforeHeader runs once, right before the header is written.
+	beforeHeader func()
+}
+
+func newResponseWriter(w http.ResponseWriter, beforeHeader func()) *responseWriter {
+	return &responseWriter{ResponseWriter: w, beforeHeader: beforeHeader}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if w.beforeHeader != nil {
+		w.beforeHeader()
+	}
+	w.wroteHeader = true
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// Sniff like net/http does for implicit headers.
+		header := w.Header()
+		if _, ok := header["Content-Type"]; !ok && header.Get("Transfer-Encoding") == "" {
+			header.Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap returns the writer passed to the handler, for http.ResponseController and
+// similar helpers.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush sends the header, if needed, and any buffered data to the client.
+func (w *responseWriter) Flush() error {
+	return w.flush(http.StatusOK)
+}
+
+// flush writes the header with status when it was not written yet.
+func (w *responseWriter) flush(status int) error {
+	var flusher http.Flusher
+	if !findWriter(w.ResponseWriter, func(rw http.ResponseWriter) (ok bool) {
+		flusher, ok = rw.(http.Flusher)
+		return ok
+	}) {
+		return http.ErrNotSupported
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(status)
+	}
+	flusher.Flush()
+	return nil
+}
+
+// Hijack takes over the connection. The response can not be written afterwards.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var hijacker http.Hijacker
+	if !findWriter(w.ResponseWriter, func(rw http.ResponseWriter) (ok bool) {
+		hijacker, ok = rw.(http.Hijacker)
+		return ok
+	}) {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err == nil {
+		// Keep the cookie hook and later writes away from the hijacked connection.
+		w.wroteHeader = true
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, buf, err
+}
+
+// Push starts an HTTP/2 server push.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	var pusher http.Pusher
+	if !findWriter(w.ResponseWriter, func(rw http.ResponseWriter) (ok bool) {
+		pusher, ok = rw.(http.Pusher)
+		return ok
+	}) {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// findWriter walks w and the writers it wraps, found through Unwrap, until match
+// returns true.
+func findWriter(w http.ResponseWriter, match func(http.ResponseWriter) bool) bool {
+	for w != nil {
+		if match(w) {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+	return false
+}
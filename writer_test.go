@@ -0,0 +1,178 @@
+package fastrex
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// countingWriter counts the WriteHeader calls that reach the client.
+type countingWriter struct {
+	*httptest.ResponseRecorder
+	headers int
+}
+
+func (c *countingWriter) WriteHeader(code int) {
+	c.headers++
+	c.ResponseRecorder.WriteHeader(code)
+}
+
+func Test_httpResponse_Written(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     HandlerFunc
+		wantStatus  int
+		wantWritten bool
+		wantSize    int64
+		wantHeaders int
+	}{
+		{
+			name: "chunks",
+			handler: func(r1 Request, r2 Response) {
+				r2.Status(201)
+				r2.Write([]byte("hello "))
+				r2.Write([]byte("world"))
+			},
+			wantStatus:  201,
+			wantWritten: true,
+			wantSize:    11,
+			wantHeaders: 1,
+		},
+		{
+			name: "json",
+			handler: func(r1 Request, r2 Response) {
+				r2.Status(202).Json(map[string]int{"a": 1})
+			},
+			wantStatus:  202,
+			wantWritten: true,
+			wantSize:    7,
+			wantHeaders: 1,
+		},
+		{
+			name: "not written",
+			handler: func(r1 Request, r2 Response) {
+				r2.Status(204)
+			},
+			wantStatus: 204,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &countingWriter{ResponseRecorder: httptest.NewRecorder()}
+			var res Response
+			var handler HandlerFunc = func(r1 Request, r2 Response) {
+				tt.handler(r1, r2)
+				res = r2
+			}
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+			if res.StatusCode() != tt.wantStatus || res.Written() != tt.wantWritten || res.Size() != tt.wantSize {
+				t.Errorf("Response = status %v written %v size %v, want %v %v %v",
+					res.StatusCode(), res.Written(), res.Size(), tt.wantStatus, tt.wantWritten, tt.wantSize)
+			}
+			if w.headers != tt.wantHeaders {
+				t.Errorf("WriteHeader called %d times, want %d", w.headers, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func Test_httpResponse_Written_middleware(t *testing.T) {
+	var mid Response
+	app := New()
+	app.Use(func(req Request, res Response, next Next) {
+		mid = res
+		next(req, res)
+	})
+	app.Get("/", func(req Request, res Response) {
+		res.Status(418).Send("teapot")
+	})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if mid.StatusCode() != 418 || !mid.Written() || mid.Size() != 6 {
+		t.Errorf("middleware Response = %v %v %v, want 418 true 6", mid.StatusCode(), mid.Written(), mid.Size())
+	}
+}
+
+func Test_httpResponse_Written_middlewareError(t *testing.T) {
+	for _, problems := range []bool{false, true} {
+		var mid Response
+		app := New().ProblemDetails(problems)
+		app.Use(func(req Request, res Response, next Next) {
+			mid = res
+			next(req.ErrorMiddleware(errors.New("denied"), 403), res)
+		})
+		app.Get("/", func(req Request, res Response) {})
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if mid.StatusCode() != 403 || !mid.Written() || mid.Size() != int64(w.Body.Len()) {
+			t.Errorf("middleware Response = %v %v %v, want 403 true %v", mid.StatusCode(), mid.Written(), mid.Size(), w.Body.Len())
+		}
+	}
+}
+
+// wrappingWriter hides the interfaces of the writer it wraps, like most middleware writers.
+type wrappingWriter struct {
+	w http.ResponseWriter
+}
+
+func (u *wrappingWriter) Header() http.Header         { return u.w.Header() }
+func (u *wrappingWriter) Write(b []byte) (int, error) { return u.w.Write(b) }
+func (u *wrappingWriter) WriteHeader(code int)        { u.w.WriteHeader(code) }
+func (u *wrappingWriter) Unwrap() http.ResponseWriter { return u.w }
+
+func Test_httpResponse_Flush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &wrappingWriter{w: rec}
+	var err, pushErr error
+	var unwrapped http.ResponseWriter
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		r2.Status(202).Write([]byte("a"))
+		err = r2.Flush()
+		pushErr = r2.Push("/app.js", nil)
+		unwrapped = r2.Unwrap()
+	}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+	if err != nil || !rec.Flushed || rec.Code != 202 {
+		t.Errorf("Response.Flush() = %v flushed %v status %v", err, rec.Flushed, rec.Code)
+	}
+	if pushErr != http.ErrNotSupported {
+		t.Errorf("Response.Push() = %v, want http.ErrNotSupported", pushErr)
+	}
+	if unwrapped != w {
+		t.Errorf("Response.Unwrap() = %v, want the handler writer", unwrapped)
+	}
+}
+
+func Test_httpResponse_Hijack(t *testing.T) {
+	app := New()
+	app.Get("/", func(req Request, res Response) {
+		conn, buf, err := res.Hijack()
+		if err != nil {
+			t.Errorf("Response.Hijack() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "hijacked" {
+		t.Errorf("Response.Hijack() body = %q, want hijacked", body)
+	}
+
+	var handler HandlerFunc = func(r1 Request, r2 Response) {
+		if _, _, err := r2.Hijack(); err != http.ErrNotSupported {
+			t.Errorf("Response.Hijack() on a recorder = %v, want http.ErrNotSupported", err)
+		}
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), nil, nil, nil, map[string]interface{}{})
+}